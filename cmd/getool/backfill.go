@@ -22,25 +22,107 @@ import (
 	"fmt"
 	"math"
 	"os"
-	"regexp"
+	"path/filepath"
 	"sort"
 	"strconv"
+	"sync/atomic"
 	"text/tabwriter"
 	"time"
 
 	"github.com/alecthomas/units"
+	"github.com/oklog/ulid/v2"
 	"github.com/prometheus/common/promslog"
 	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/statsd_exporter/pkg/mapper"
+	"golang.org/x/sync/errgroup"
 
+	"github.com/prometheus/graphite_exporter/collector"
 	"github.com/prometheus/graphite_exporter/reader"
 )
 
-var invalidMetricChars = regexp.MustCompile("[^a-zA-Z0-9_:]")
+// backfillSeries is a metric to import along with the labels of its series.
+type backfillSeries struct {
+	metric string
+	labels labels.Labels
+}
+
+// backfillProgress counts the work done in the current stage of an import.
+type backfillProgress struct {
+	stage   atomic.Pointer[string]
+	done    atomic.Int64
+	total   atomic.Int64
+	samples atomic.Int64
+}
+
+func (p *backfillProgress) start(stage string, total int) {
+	p.stage.Store(&stage)
+	p.done.Store(0)
+	p.total.Store(int64(total))
+	p.samples.Store(0)
+}
+
+func (p *backfillProgress) report(start time.Time) {
+	fmt.Fprintf(os.Stderr, "%s: %d/%d, %d samples (%s elapsed)\n",
+		*p.stage.Load(), p.done.Load(), p.total.Load(), p.samples.Load(), time.Since(start).Round(time.Second))
+}
+
+// mapSeries determines the series of each metric, skipping metrics that are
+// filtered out or dropped by the mapping configuration. Like in the exporter,
+// the tags of a metric become labels and the mapping applies to its path.
+// Invalid tags are left out.
+func mapSeries(metrics []string, metricMapper *mapper.MetricMapper, opts backfillOptions) []backfillSeries {
+	series := make([]backfillSeries, 0, len(metrics))
+	for _, m := range metrics {
+		path, tags, _ := collector.ParseMetricNameAndTags(m, opts.namingScheme)
+		if !opts.filter.matches(path) {
+			continue
+		}
+		mapping, mappingLabels, mappingPresent := metricMapper.GetMapping(path, mapper.MetricTypeGauge)
+
+		if (mappingPresent && mapping.Action == mapper.ActionTypeDrop) || (!mappingPresent && opts.strictMatch) {
+			continue
+		}
+
+		var name string
+		if mappingPresent {
+			name = opts.namingScheme.MappedName(mapping.Name)
+		} else {
+			name = opts.namingScheme.MetricName(path)
+		}
+
+		builder := labels.NewBuilder(labels.EmptyLabels())
+		builder.Set("__name__", name)
+
+		// add mapping labels to parsed labels
+		for k, v := range mappingLabels {
+			tags[k] = v
+		}
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			builder.Set(k, tags[k])
+		}
+		series = append(series, backfillSeries{metric: m, labels: builder.Labels()})
+	}
+	return series
+}
 
-func createBlocks(input reader.DBReader, mint, maxt, blockDuration int64, maxSamplesInAppender int, outputDir string, metricMapper *mapper.MetricMapper, strictMatch, humanReadable bool) (returnErr error) {
-	mint = blockDuration * (mint / blockDuration)
+// createBlocks imports the metrics in two stages. First, each metric is read
+// once and its samples are spilled to a temporary file per block. Then the
+// blocks are built one after the other from those files. This way, every
+// metric is read once, and only one block is held in memory at a time.
+//
+// Completed blocks are recorded in a checkpoint, and blocks that an earlier
+// import completed are skipped when it is resumed. Once the import completes,
+// the checkpoint records its parameters instead, so that it is not run again.
+func createBlocks(input reader.DBReader, mint, maxt int64, outputDir string, metricMapper *mapper.MetricMapper, opts backfillOptions) (returnErr error) {
+	blockDuration := opts.blockDuration.Milliseconds()
+	blockStart := blockDuration * (mint / blockDuration)
 
 	db, err := tsdb.OpenDBReadOnly(outputDir, "", nil)
 	if err != nil {
@@ -50,67 +132,218 @@ func createBlocks(input reader.DBReader, mint, maxt, blockDuration int64, maxSam
 		returnErr = errors.Join(returnErr, db.Close())
 	}()
 
-	var wroteHeader bool
-
 	metrics, err := input.Metrics()
 	if err != nil {
 		return err
 	}
+	if s, ok := input.(reader.LineSkipper); ok && s.SkippedLines() > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d lines that could not be parsed\n", s.SkippedLines())
+	}
+	series := mapSeries(metrics, metricMapper, opts)
 
-	for t := mint; t <= maxt; t = t + blockDuration {
-		tsUpper := t + blockDuration
-		err := func() error {
-			// To prevent races with compaction, a block writer only allows appending samples
-			// that are at most half a block size older than the most recent sample appended so far.
-			// However, in the way we use the block writer here, compaction doesn't happen, while we
-			// also need to append samples throughout the whole block range. To allow that, we
-			// pretend that the block is twice as large here, but only really add sample in the
-			// original interval later.
-			w, err := tsdb.NewBlockWriter(promslog.NewNopLogger(), outputDir, 2*blockDuration)
-			if err != nil {
-				return fmt.Errorf("block writer: %w", err)
-			}
-			defer func() {
-				err = errors.Join(err, w.Close())
-			}()
-
-			ctx := context.Background()
-			app := w.Appender(ctx)
-			samplesCount := 0
-			for _, m := range metrics {
-				mapping, mappingLabels, mappingPresent := metricMapper.GetMapping(m, mapper.MetricTypeGauge)
+	params, err := newImportParams(opts)
+	if err != nil {
+		return err
+	}
+	cp, err := openCheckpoint(outputDir, params, opts.resume)
+	if err != nil {
+		return err
+	}
+	if n := len(cp.Blocks); n > 0 {
+		fmt.Fprintf(os.Stderr, "skipping %d blocks completed by an earlier import\n", n)
+	}
+	staging := filepath.Join(outputDir, stagingDir)
+	if err := os.MkdirAll(staging, 0o777); err != nil {
+		return err
+	}
 
-				if (mappingPresent && mapping.Action == mapper.ActionTypeDrop) || (!mappingPresent && strictMatch) {
-					continue
+	spillDir, err := os.MkdirTemp(outputDir, ".spill-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, os.RemoveAll(spillDir))
+	}()
+	sp := newSpill(spillDir, max(opts.maxBufferedSamples, 1))
+
+	progress := &backfillProgress{}
+	progress.start("reading metrics", len(series))
+	start := time.Now()
+	if opts.progressInterval > 0 {
+		ticker := time.NewTicker(opts.progressInterval)
+		done := make(chan struct{})
+		defer func() {
+			ticker.Stop()
+			close(done)
+		}()
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					progress.report(start)
+				case <-done:
+					return
 				}
+			}
+		}()
+	}
 
-				var name string
-				if mappingPresent {
-					name = invalidMetricChars.ReplaceAllString(mapping.Name, "_")
-				} else {
-					name = invalidMetricChars.ReplaceAllString(m, "_")
-				}
+	if err := readSeries(input, series, mint, maxt, blockStart, blockDuration, cp, sp, opts, progress); err != nil {
+		return err
+	}
+	if opts.progressInterval > 0 {
+		progress.report(start)
+	}
 
-				builder := labels.NewBuilder(labels.EmptyLabels())
-				builder.Set("__name__", name)
+	blocks := sp.blockStarts()
+	progress.start("writing blocks", len(blocks))
+	var wroteHeader bool
+	for _, t := range blocks {
+		block, err := writeBlock(sp, t, series, staging, opts, progress)
+		if err != nil {
+			return fmt.Errorf("process blocks: %w", err)
+		}
+		if err := sp.remove(t); err != nil {
+			return err
+		}
+		// The block is recorded before it is moved, so that a block in the
+		// output directory is never built again.
+		if err := cp.add(t, block); err != nil {
+			return err
+		}
+		progress.done.Add(1)
+		if block == (ulid.ULID{}) {
+			continue
+		}
+		if err := os.Rename(filepath.Join(staging, block.String()), filepath.Join(outputDir, block.String())); err != nil {
+			return err
+		}
 
-				keys := make([]string, 0, len(mappingLabels))
-				for k := range mappingLabels {
-					keys = append(keys, k)
-				}
-				sort.Strings(keys)
-				// add mapping labels to parsed labels·
-				for _, k := range keys {
-					builder.Set(k, mappingLabels[k])
-				}
-				l := builder.Labels()
+		dbBlocks, err := db.Blocks()
+		if err != nil {
+			return fmt.Errorf("get blocks: %w", err)
+		}
+		for _, b := range dbBlocks {
+			if b.Meta().ULID == block {
+				printBlocks([]tsdb.BlockReader{b}, !wroteHeader, opts.humanReadable)
+				wroteHeader = true
+				break
+			}
+		}
+	}
+	if opts.progressInterval > 0 {
+		progress.report(start)
+	}
+	if err := os.Remove(staging); err != nil {
+		return err
+	}
+	return cp.complete()
+}
 
-				points, err := input.Points(m, t, tsUpper)
+// readSeries reads the points of each series between mint and maxt in
+// parallel, and spills them by block. Blocks are aligned to blockStart, and
+// those already completed according to the checkpoint are skipped.
+func readSeries(input reader.DBReader, series []backfillSeries, mint, maxt, blockStart, blockDuration int64, cp *checkpoint, sp *spill, opts backfillOptions, progress *backfillProgress) error {
+	g, ctx := errgroup.WithContext(context.Background())
+	next := make(chan int)
+	g.Go(func() error {
+		defer close(next)
+		for i := range series {
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	})
+	for range max(opts.workers, 1) {
+		g.Go(func() error {
+			for i := range next {
+				// Points returns points after the start of the range, so
+				// start just before mint to include a point at mint.
+				points, err := input.Points(series[i].metric, mint-1, maxt)
 				if err != nil {
 					return err
 				}
-				for _, point := range points {
-					if _, err := app.Append(0, l, point.Timestamp, point.Value); err != nil {
+				for len(points) > 0 {
+					if points[0].Timestamp < mint || points[0].Timestamp > maxt {
+						points = points[1:]
+						continue
+					}
+					block := blockStart + blockDuration*((points[0].Timestamp-blockStart)/blockDuration)
+					n := sort.Search(len(points), func(j int) bool { return points[j].Timestamp >= block+blockDuration })
+					if !cp.completed(block) {
+						if err := sp.add(block, uint32(i), points[:n]); err != nil {
+							return err
+						}
+						progress.samples.Add(int64(n))
+					}
+					points = points[n:]
+				}
+				progress.done.Add(1)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return sp.flush()
+}
+
+// writeBlock builds the block starting at t from its spilled samples. The
+// samples are appended in parallel, with all samples of a series going to the
+// same worker so that they are appended in order. Several metrics can result
+// in the same series, so workers are chosen by the labels of the series, not
+// by metric. Where the samples of such metrics overlap, the ones appended
+// first are kept. It returns the ULID of the block, or a zero ULID if there
+// were no samples.
+func writeBlock(sp *spill, t int64, series []backfillSeries, outputDir string, opts backfillOptions, progress *backfillProgress) (_ ulid.ULID, err error) {
+	blockDuration := opts.blockDuration.Milliseconds()
+	workers := max(opts.workers, 1)
+	// Each worker commits its appender once it holds its share of the
+	// samples, so that at most maxBufferedSamples samples are lined up in
+	// appenders at any time.
+	maxSamplesInAppender := max(opts.maxBufferedSamples/workers, 1)
+
+	// To prevent races with compaction, a block writer only allows appending samples
+	// that are at most half a block size older than the most recent sample appended so far.
+	// However, in the way we use the block writer here, compaction doesn't happen, while we
+	// also need to append samples throughout the whole block range. To allow that, we
+	// pretend that the block is twice as large here, but only really add sample in the
+	// original interval later.
+	w, err := tsdb.NewBlockWriter(promslog.NewNopLogger(), outputDir, 2*blockDuration)
+	if err != nil {
+		return ulid.ULID{}, fmt.Errorf("block writer: %w", err)
+	}
+	defer func() {
+		err = errors.Join(err, w.Close())
+	}()
+
+	worker := make([]int, len(series))
+	for i, s := range series {
+		worker[i] = int(s.labels.Hash() % uint64(workers))
+	}
+
+	const batchSize = 1024
+	g, ctx := errgroup.WithContext(context.Background())
+	batches := make([]chan []spilledSample, workers)
+	for i := range batches {
+		ch := make(chan []spilledSample, 1)
+		batches[i] = ch
+		g.Go(func() error {
+			app := w.Appender(ctx)
+			samplesCount := 0
+			for batch := range ch {
+				for _, s := range batch {
+					_, err := app.Append(0, series[s.series].labels, s.timestamp, s.value)
+					switch {
+					case errors.Is(err, storage.ErrOutOfOrderSample), errors.Is(err, storage.ErrDuplicateSampleForTimestamp):
+						// Another metric with the same series already has a
+						// sample at or after this one.
+						continue
+					case err != nil:
 						return fmt.Errorf("add sample: %w", err)
 					}
 
@@ -129,38 +362,63 @@ func createBlocks(input reader.DBReader, mint, maxt, blockDuration int64, maxSam
 					app = w.Appender(ctx)
 					samplesCount = 0
 				}
+				progress.samples.Add(int64(len(batch)))
 			}
-
 			if err := app.Commit(); err != nil {
 				return fmt.Errorf("commit: %w", err)
 			}
-
-			block, err := w.Flush(ctx)
-			switch {
-			case err == nil:
-				blocks, err := db.Blocks()
-				if err != nil {
-					return fmt.Errorf("get blocks: %w", err)
-				}
-				for _, b := range blocks {
-					if b.Meta().ULID == block {
-						printBlocks([]tsdb.BlockReader{b}, !wroteHeader, humanReadable)
-						wroteHeader = true
-						break
-					}
-				}
-			case errors.Is(err, tsdb.ErrNoSeriesAppended):
-			default:
-				return fmt.Errorf("flush: %w", err)
-			}
-
 			return nil
+		})
+	}
+	g.Go(func() error {
+		defer func() {
+			for _, ch := range batches {
+				close(ch)
+			}
 		}()
+		pending := make([][]spilledSample, workers)
+		send := func(i int) error {
+			select {
+			case batches[i] <- pending[i]:
+				pending[i] = make([]spilledSample, 0, batchSize)
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		err := sp.read(t, func(s spilledSample) error {
+			i := worker[s.series]
+			pending[i] = append(pending[i], s)
+			if len(pending[i]) < batchSize {
+				return nil
+			}
+			return send(i)
+		})
 		if err != nil {
-			return fmt.Errorf("process blocks: %w", err)
+			return err
+		}
+		for i := range pending {
+			if len(pending[i]) > 0 {
+				if err := send(i); err != nil {
+					return err
+				}
+			}
 		}
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		return ulid.ULID{}, err
+	}
+
+	block, err := w.Flush(context.Background())
+	switch {
+	case err == nil:
+		return block, nil
+	case errors.Is(err, tsdb.ErrNoSeriesAppended):
+		return ulid.ULID{}, nil
+	default:
+		return ulid.ULID{}, fmt.Errorf("flush: %w", err)
 	}
-	return nil
 }
 
 func printBlocks(blocks []tsdb.BlockReader, writeHeader, humanReadable bool) {
@@ -202,16 +460,45 @@ func getFormatedBytes(bytes int64, humanReadable bool) string {
 	return strconv.FormatInt(bytes, 10)
 }
 
-func backfill(maxSamplesInAppender int, inputDir, outputDir, mappingConfig string, strictMatch, humanReadable bool, blockDuration int64) (err error) {
-	wdb := reader.NewReader(inputDir)
-	mint, maxt, err := wdb.GetMinAndMaxTimestamps()
-	if err != nil {
-		return fmt.Errorf("getting min and max timestamp: %w", err)
+func newInputReader(input string, opts backfillOptions) reader.DBReader {
+	switch opts.inputFormat {
+	case "ceres":
+		return reader.NewCeresReader(input)
+	case "plaintext":
+		return reader.NewPlaintextReader(input)
+	case "render":
+		return reader.NewRenderReader(input, opts.renderConcurrency, opts.renderRateLimit)
+	default:
+		return reader.NewReaderWithArchives(input, reader.ArchiveMode(opts.archives))
+	}
+}
+
+func backfill(inputDir, outputDir string, opts backfillOptions) (err error) {
+	if opts.inputFormat == "render" && (opts.start.IsZero() || opts.end.IsZero()) {
+		return errors.New("--start and --end are required to read from the Graphite API")
+	}
+	wdb := newInputReader(inputDir, opts)
+	// The bounds of the files are not needed if the time range is given.
+	mint, maxt := opts.start.UnixMilli(), opts.end.UnixMilli()
+	if opts.start.IsZero() || opts.end.IsZero() {
+		fileMint, fileMaxt, err := wdb.GetMinAndMaxTimestamps()
+		if err != nil {
+			return fmt.Errorf("getting min and max timestamp: %w", err)
+		}
+		if opts.start.IsZero() {
+			mint = fileMint
+		}
+		if opts.end.IsZero() {
+			maxt = fileMaxt
+		}
+	}
+	if mint > maxt {
+		return errors.New("no samples in the selected time range")
 	}
 	metricMapper := &mapper.MetricMapper{}
 
-	if mappingConfig != "" {
-		err := metricMapper.InitFromFile(mappingConfig)
+	if opts.mappingConfig != "" {
+		err := metricMapper.InitFromFile(opts.mappingConfig)
 		if err != nil {
 			logger := promslog.New(&promslog.Config{})
 			logger.Error("Error loading metric mapping config", "err", err)
@@ -219,24 +506,23 @@ func backfill(maxSamplesInAppender int, inputDir, outputDir, mappingConfig strin
 		}
 	}
 
-	if err := createBlocks(wdb, mint, maxt, blockDuration, maxSamplesInAppender, outputDir, metricMapper, strictMatch, humanReadable); err != nil {
+	opts.input = inputDir
+	if err := createBlocks(wdb, mint, maxt, outputDir, metricMapper, opts); err != nil {
 		return fmt.Errorf("block creation: %w", err)
 	}
 	return nil
 }
 
-func backfillWhisper(inputDir, outputDir, mappingConfig string, strictMatch, humanReadable bool, optBlockDuration time.Duration) (err error) {
-	blockDuration := int64(time.Duration(optBlockDuration) / time.Millisecond)
-
-	if !validateBlockDuration(blockDuration) {
-		return fmt.Errorf("invalid block duration: %s", optBlockDuration.String())
+func backfillWhisper(inputDir, outputDir string, opts backfillOptions) (err error) {
+	if !validateBlockDuration(opts.blockDuration.Milliseconds()) {
+		return fmt.Errorf("invalid block duration: %s", opts.blockDuration.String())
 	}
 
 	if err := os.MkdirAll(outputDir, 0o777); err != nil {
 		return fmt.Errorf("create output dir: %w", err)
 	}
 
-	return backfill(5000, inputDir, outputDir, mappingConfig, strictMatch, humanReadable, blockDuration)
+	return backfill(inputDir, outputDir, opts)
 }
 
 func validateBlockDuration(t int64) bool {
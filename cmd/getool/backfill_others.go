@@ -18,9 +18,12 @@ package main
 
 import (
 	"errors"
-	"time"
 )
 
-func backfillWhisper(inputDir, outputDir, mappingConfig string, strictMatch, humanReadable bool, optBlockDuration time.Duration) (err error) {
+func backfillWhisper(inputDir, outputDir string, opts backfillOptions) (err error) {
 	return errors.New("backfilling is not supported for this architecture")
 }
+
+func mappingSuggest(inputDir string, minVariants int) error {
+	return errors.New("reading whisper databases is not supported for this architecture")
+}
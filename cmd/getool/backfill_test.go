@@ -17,21 +17,34 @@
 package main
 
 import (
+	"cmp"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
 	"io"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/go-graphite/go-whisper"
 	"github.com/prometheus/prometheus/model/labels"
-	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
 	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/graphite_exporter/reader"
 )
 
 func TestBackfill(t *testing.T) {
@@ -44,6 +57,7 @@ func TestBackfill(t *testing.T) {
 		labels        map[string]string
 		mappingConfig string
 		strictMatch   bool
+		namingScheme  string
 	}{
 		{
 			name:       "default",
@@ -73,6 +87,16 @@ mappings:
 			metricName: "load_cpu",
 			labels:     map[string]string{"cpu": "cpu0"},
 		},
+		{
+			name:         "utf8",
+			namingScheme: "utf8",
+			metricName:   "load.cpu.cpu0",
+		},
+		{
+			name:         "dots",
+			namingScheme: "dots",
+			metricName:   "load_dot_cpu_dot_cpu0",
+		},
 	} {
 		tt := tt // TODO(matthias): remove after upgrading to Go 1.22
 		t.Run(tt.name, func(t *testing.T) {
@@ -110,6 +134,10 @@ mappings:
 				arguments = append(arguments, "--graphite.mapping-strict-match")
 			}
 
+			if tt.namingScheme != "" {
+				arguments = append(arguments, "--graphite.naming-scheme", tt.namingScheme)
+			}
+
 			arguments = append(arguments, filepath.Join(tmpData, "whisper"), filepath.Join(tmpData, "data"))
 
 			cmd := exec.Command(testPath, arguments...)
@@ -128,14 +156,7 @@ mappings:
 			err = cmd.Wait()
 			require.NoError(t, err)
 
-			require.NoError(t, os.MkdirAll(filepath.Join(tmpData, "data", "wal"), 0o777))
-
-			db, err := tsdb.OpenDBReadOnly(filepath.Join(tmpData, "data"), "", nil)
-			require.NoError(t, err)
-			q, err := db.Querier(math.MinInt64, math.MaxInt64)
-			require.NoError(t, err)
-
-			s := queryAllSeries(t, q)
+			s := readSamples(t, filepath.Join(tmpData, "data"))
 
 			ll := labels.FromMap(tt.labels)
 
@@ -160,21 +181,47 @@ type backfillSample struct {
 	Labels    labels.Labels
 }
 
-func queryAllSeries(t *testing.T, q storage.Querier) []backfillSample {
-	ss := q.Select(context.Background(), false, nil, labels.MustNewMatcher(labels.MatchRegexp, "", ".*"))
+// readSamples returns the samples in a TSDB directory that match the
+// matchers, or all samples if there are none.
+func readSamples(t *testing.T, dir string, matchers ...*labels.Matcher) []backfillSample {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "wal"), 0o777))
+	db, err := tsdb.OpenDBReadOnly(dir, "", nil)
+	require.NoError(t, err)
+	defer db.Close()
+	q, err := db.Querier(math.MinInt64, math.MaxInt64)
+	require.NoError(t, err)
+	defer q.Close()
+
+	if len(matchers) == 0 {
+		matchers = []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "", ".*")}
+	}
+	ss := q.Select(context.Background(), false, nil, matchers...)
 	samples := []backfillSample{}
 	for ss.Next() {
 		series := ss.At()
 		it := series.Iterator(nil)
-		require.NoError(t, it.Err())
 		for it.Next() != chunkenc.ValNone {
 			ts, v := it.At()
 			samples = append(samples, backfillSample{Timestamp: ts, Value: v, Labels: series.Labels()})
 		}
+		require.NoError(t, it.Err())
 	}
+	require.NoError(t, ss.Err())
 	return samples
 }
 
+// countSamples returns the number of samples of each metric name in a TSDB
+// directory, counting the samples that match the matchers.
+func countSamples(t *testing.T, dir string, matchers ...*labels.Matcher) map[string]int {
+	t.Helper()
+	counts := map[string]int{}
+	for _, s := range readSamples(t, dir, matchers...) {
+		counts[s.Labels.Get("__name__")]++
+	}
+	return counts
+}
+
 func TestValidateBlockSize(t *testing.T) {
 	require.True(t, validateBlockDuration(int64(time.Duration(2*time.Hour)/time.Millisecond)))
 	require.True(t, validateBlockDuration(int64(time.Duration(4*time.Hour)/time.Millisecond)))
@@ -185,3 +232,475 @@ func TestValidateBlockSize(t *testing.T) {
 	require.False(t, validateBlockDuration(int64(time.Duration(3*time.Hour)/time.Millisecond)))
 	require.False(t, validateBlockDuration(int64(time.Duration(11*time.Hour)/time.Millisecond)))
 }
+
+// createWhisperTree creates whisper files for the metrics servers.sNNN.load,
+// with a point every minute over the last day, and returns the number of
+// points per metric. The values are the number of the server.
+func createWhisperTree(t testing.TB, dir string, metrics int) int {
+	retentions, err := whisper.ParseRetentionDefs("1m:1d")
+	require.NoError(t, err)
+	now := int(time.Now().Unix())
+	now -= now % 60
+	for i := range metrics {
+		path := filepath.Join(dir, "servers", fmt.Sprintf("s%03d", i))
+		require.NoError(t, os.MkdirAll(path, 0o777))
+		wsp, err := whisper.Create(filepath.Join(path, "load.wsp"), retentions, whisper.Average, 0.5)
+		require.NoError(t, err)
+		points := make([]*whisper.TimeSeriesPoint, 0, 24*60)
+		for ts := now - 24*60*60 + 60; ts <= now; ts += 60 {
+			points = append(points, &whisper.TimeSeriesPoint{Time: ts, Value: float64(i)})
+		}
+		require.NoError(t, wsp.UpdateMany(points))
+		require.NoError(t, wsp.Close())
+	}
+	return 24 * 60
+}
+
+// countingReader counts the calls to Points.
+type countingReader struct {
+	reader.DBReader
+	calls atomic.Int64
+}
+
+func (r *countingReader) Points(metric string, from, until int64) ([]reader.Point, error) {
+	r.calls.Add(1)
+	return r.DBReader.Points(metric, from, until)
+}
+
+func TestCreateBlocks(t *testing.T) {
+	whisperDir := t.TempDir()
+	outputDir := t.TempDir()
+	pointsPerMetric := createWhisperTree(t, whisperDir, 20)
+
+	input := &countingReader{DBReader: reader.NewReader(whisperDir)}
+	mint, maxt, err := input.GetMinAndMaxTimestamps()
+	require.NoError(t, err)
+	require.NoError(t, createBlocks(input, mint, maxt, outputDir, &mapper.MetricMapper{}, backfillOptions{
+		namingScheme:       "legacy",
+		blockDuration:      2 * time.Hour,
+		workers:            4,
+		maxBufferedSamples: 7,
+	}))
+	// The points of each metric are read once for all blocks.
+	require.Equal(t, int64(20), input.calls.Load())
+	spills, err := filepath.Glob(filepath.Join(outputDir, ".spill-*"))
+	require.NoError(t, err)
+	require.Empty(t, spills)
+
+	counts := map[string]int{}
+	for _, s := range readSamples(t, outputDir) {
+		name := s.Labels.Get("__name__")
+		var server int
+		_, err := fmt.Sscanf(name, "servers_s%d_load", &server)
+		require.NoError(t, err)
+		require.Equal(t, float64(server), s.Value, name)
+		counts[name]++
+	}
+	require.Len(t, counts, 20)
+	for name, n := range counts {
+		require.Equal(t, pointsPerMetric, n, name)
+	}
+}
+
+func TestCreateBlocksCollidingMetrics(t *testing.T) {
+	whisperDir := t.TempDir()
+	outputDir := t.TempDir()
+	retentions, err := whisper.ParseRetentionDefs("1m:1d")
+	require.NoError(t, err)
+	now := int(time.Now().Unix())
+	now -= now % 60
+	// Both paths result in the series a_b_c.
+	for i, dir := range []string{"a-b", "a_b"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(whisperDir, dir), 0o777))
+		wsp, err := whisper.Create(filepath.Join(whisperDir, dir, "c.wsp"), retentions, whisper.Average, 0.5)
+		require.NoError(t, err)
+		points := make([]*whisper.TimeSeriesPoint, 0, 24*60)
+		for ts := now - 24*60*60 + 60; ts <= now; ts += 60 {
+			points = append(points, &whisper.TimeSeriesPoint{Time: ts, Value: float64(i)})
+		}
+		require.NoError(t, wsp.UpdateMany(points))
+		require.NoError(t, wsp.Close())
+	}
+
+	input := reader.NewReader(whisperDir)
+	mint, maxt, err := input.GetMinAndMaxTimestamps()
+	require.NoError(t, err)
+	require.NoError(t, createBlocks(input, mint, maxt, outputDir, &mapper.MetricMapper{}, backfillOptions{
+		namingScheme:       "legacy",
+		blockDuration:      2 * time.Hour,
+		workers:            4,
+		maxBufferedSamples: 100,
+	}))
+	require.Equal(t, map[string]int{"a_b_c": 24 * 60}, countSamples(t, outputDir, labels.MustNewMatcher(labels.MatchEqual, "__name__", "a_b_c")))
+}
+
+func TestCreateBlocksResume(t *testing.T) {
+	whisperDir := t.TempDir()
+	outputDir := t.TempDir()
+	pointsPerMetric := createWhisperTree(t, whisperDir, 5)
+
+	input := reader.NewReader(whisperDir)
+	mint, maxt, err := input.GetMinAndMaxTimestamps()
+	require.NoError(t, err)
+	mappingConfig := filepath.Join(t.TempDir(), "mapping.yaml")
+	require.NoError(t, os.WriteFile(mappingConfig, []byte("mappings: []\n"), 0o666))
+	opts := backfillOptions{
+		namingScheme:       "legacy",
+		blockDuration:      2 * time.Hour,
+		workers:            2,
+		maxBufferedSamples: 5000,
+		mappingConfig:      mappingConfig,
+	}
+	require.NoError(t, createBlocks(input, mint, maxt, outputDir, &mapper.MetricMapper{}, opts))
+	require.NoDirExists(t, filepath.Join(outputDir, stagingDir))
+
+	// A completed import is neither resumed nor run again, as that would
+	// create duplicate blocks.
+	require.ErrorContains(t, createBlocks(input, mint, maxt, outputDir, &mapper.MetricMapper{}, opts), "already completed")
+	opts.resume = true
+	require.ErrorContains(t, createBlocks(input, mint, maxt, outputDir, &mapper.MetricMapper{}, opts), "already completed")
+	opts.resume = false
+
+	// Simulate an import that was interrupted while writing blocks: the
+	// last block was built but not recorded, the one before was recorded
+	// but not moved, the one before that was not built yet, and temporary
+	// files were left behind.
+	blocks := completedBlocks(t, outputDir, opts.blockDuration)
+	require.Greater(t, len(blocks), 3)
+	params, err := newImportParams(opts)
+	require.NoError(t, err)
+	cp := checkpoint{Params: &params}
+	unrecorded, unmoved := blocks[len(blocks)-1].ULID.String(), blocks[len(blocks)-2].ULID.String()
+	require.NoError(t, os.RemoveAll(filepath.Join(outputDir, blocks[len(blocks)-3].ULID.String())))
+	require.NoError(t, os.MkdirAll(filepath.Join(outputDir, stagingDir), 0o777))
+	require.NoError(t, os.Rename(filepath.Join(outputDir, unrecorded), filepath.Join(outputDir, stagingDir, unrecorded)))
+	require.NoError(t, os.Rename(filepath.Join(outputDir, unmoved), filepath.Join(outputDir, stagingDir, unmoved)))
+	require.NoError(t, os.MkdirAll(filepath.Join(outputDir, ".spill-123"), 0o777))
+	cp.Blocks = append(slices.Clone(blocks[:len(blocks)-3]), blocks[len(blocks)-2])
+	data, err := json.Marshal(cp)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, checkpointFile), data, 0o666))
+
+	// Rerunning without resuming would create duplicate blocks, and
+	// resuming with other parameters would skip blocks that were not
+	// imported with them.
+	require.ErrorContains(t, createBlocks(input, mint, maxt, outputDir, &mapper.MetricMapper{}, opts), "use --resume")
+	opts.resume = true
+	other := opts
+	other.filter, err = newMetricFilter([]string{"servers.*"}, nil, nil, nil)
+	require.NoError(t, err)
+	require.EqualError(t, createBlocks(input, mint, maxt, outputDir, &mapper.MetricMapper{}, other), "the import to resume was started with a different filter")
+	require.NoError(t, os.WriteFile(mappingConfig, []byte("mappings: []\n# edited\n"), 0o666))
+	require.EqualError(t, createBlocks(input, mint, maxt, outputDir, &mapper.MetricMapper{}, opts), "the import to resume was started with a different mapping_config_sha256")
+	require.NoError(t, os.WriteFile(mappingConfig, []byte("mappings: []\n"), 0o666))
+
+	counting := &countingReader{DBReader: input}
+	require.NoError(t, createBlocks(counting, mint, maxt, outputDir, &mapper.MetricMapper{}, opts))
+	require.Equal(t, int64(5), counting.calls.Load())
+
+	for _, pattern := range []string{".spill-*", stagingDir} {
+		leftovers, err := filepath.Glob(filepath.Join(outputDir, pattern))
+		require.NoError(t, err)
+		require.Empty(t, leftovers, pattern)
+	}
+	require.NoDirExists(t, filepath.Join(outputDir, unrecorded))
+	require.DirExists(t, filepath.Join(outputDir, unmoved))
+
+	data, err = os.ReadFile(filepath.Join(outputDir, checkpointFile))
+	require.NoError(t, err)
+	cp = checkpoint{}
+	require.NoError(t, json.Unmarshal(data, &cp))
+	require.Equal(t, checkpoint{Completed: []importParams{params}}, cp)
+
+	require.Len(t, completedBlocks(t, outputDir, opts.blockDuration), len(blocks))
+	counts := countSamples(t, outputDir)
+	require.Len(t, counts, 5)
+	for name, n := range counts {
+		require.Equal(t, pointsPerMetric, n, name)
+	}
+}
+
+// completedBlocks returns the blocks in the output directory as they would
+// be recorded in a checkpoint, ordered by time.
+func completedBlocks(t *testing.T, outputDir string, blockDuration time.Duration) []checkpointBlock {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Join(outputDir, "wal"), 0o777))
+	db, err := tsdb.OpenDBReadOnly(outputDir, "", nil)
+	require.NoError(t, err)
+	defer db.Close()
+	dbBlocks, err := db.Blocks()
+	require.NoError(t, err)
+
+	blocks := make([]checkpointBlock, 0, len(dbBlocks))
+	for _, b := range dbBlocks {
+		meta := b.Meta()
+		blocks = append(blocks, checkpointBlock{
+			Start: meta.MinTime - meta.MinTime%blockDuration.Milliseconds(),
+			ULID:  meta.ULID,
+		})
+	}
+	slices.SortFunc(blocks, func(a, b checkpointBlock) int { return cmp.Compare(a.Start, b.Start) })
+	return blocks
+}
+
+func BenchmarkCreateBlocks(b *testing.B) {
+	whisperDir := b.TempDir()
+	createWhisperTree(b, whisperDir, 200)
+	input := reader.NewReader(whisperDir)
+	mint, maxt, err := input.GetMinAndMaxTimestamps()
+	require.NoError(b, err)
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for range b.N {
+				require.NoError(b, createBlocks(input, mint, maxt, b.TempDir(), &mapper.MetricMapper{}, backfillOptions{
+					namingScheme:       "legacy",
+					blockDuration:      2 * time.Hour,
+					workers:            workers,
+					maxBufferedSamples: 5000,
+				}))
+			}
+		})
+	}
+}
+
+func TestBackfillTimeRangeAndFilter(t *testing.T) {
+	whisperDir := t.TempDir()
+	outputDir := t.TempDir()
+	createWhisperTree(t, whisperDir, 20)
+
+	now := time.Now().Unix()
+	now -= now % 60
+	start, end := time.Unix(now-5*3600, 0), time.Unix(now-3600, 0)
+	filter, err := newMetricFilter([]string{"servers.s00*.load"}, nil, nil, []string{"s00[5-9]"})
+	require.NoError(t, err)
+	require.NoError(t, backfill(whisperDir, outputDir, backfillOptions{
+		start:              start,
+		end:                end,
+		filter:             filter,
+		namingScheme:       "legacy",
+		blockDuration:      2 * time.Hour,
+		maxBufferedSamples: 5000,
+	}))
+
+	counts := map[string]int{}
+	for _, s := range readSamples(t, outputDir) {
+		require.GreaterOrEqual(t, s.Timestamp, start.UnixMilli())
+		require.LessOrEqual(t, s.Timestamp, end.UnixMilli())
+		counts[s.Labels.Get("__name__")]++
+	}
+	// Both start and end are included.
+	require.Equal(t, map[string]int{
+		"servers_s000_load": 241,
+		"servers_s001_load": 241,
+		"servers_s002_load": 241,
+		"servers_s003_load": 241,
+		"servers_s004_load": 241,
+	}, counts)
+}
+
+func TestBackfillIntoSameDirectory(t *testing.T) {
+	whisperDir := t.TempDir()
+	outputDir := t.TempDir()
+	pointsPerMetric := createWhisperTree(t, whisperDir, 10)
+
+	// Import the metrics in two parts, like one team at a time.
+	for _, include := range []string{"servers.s00[0-4].load", "servers.s00[5-9].load"} {
+		filter, err := newMetricFilter([]string{include}, nil, nil, nil)
+		require.NoError(t, err)
+		require.NoError(t, backfill(whisperDir, outputDir, backfillOptions{
+			filter:             filter,
+			namingScheme:       "legacy",
+			blockDuration:      2 * time.Hour,
+			maxBufferedSamples: 5000,
+		}), include)
+	}
+
+	// Running one of the imports again would duplicate its samples.
+	filter, err := newMetricFilter([]string{"servers.s00[0-4].load"}, nil, nil, nil)
+	require.NoError(t, err)
+	require.ErrorContains(t, backfill(whisperDir, outputDir, backfillOptions{
+		filter:             filter,
+		namingScheme:       "legacy",
+		blockDuration:      2 * time.Hour,
+		maxBufferedSamples: 5000,
+	}), "already completed")
+
+	counts := countSamples(t, outputDir)
+	require.Len(t, counts, 10)
+	for name, n := range counts {
+		require.Equal(t, pointsPerMetric, n, name)
+	}
+}
+
+func TestBackfillPlaintext(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+
+	f, err := os.Create(filepath.Join(inputDir, "relay.log.gz"))
+	require.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	now := time.Now().Unix()
+	for i := range 3 {
+		fmt.Fprintf(gz, "servers.s%d.load %d %d\n", i, i, now-3600)
+		fmt.Fprintf(gz, "servers.s%d.load %d %d\n", i, i+10, now)
+		// Junk lines are skipped.
+		fmt.Fprintf(gz, "servers.s%d.load\n", i)
+	}
+	require.NoError(t, gz.Close())
+	require.NoError(t, f.Close())
+
+	mappingConfig := filepath.Join(t.TempDir(), "mapping.yaml")
+	require.NoError(t, os.WriteFile(mappingConfig, []byte(`
+mappings:
+- match: servers.*.load
+  name: load
+  labels:
+    server: $1
+`), 0o666))
+
+	require.NoError(t, backfill(inputDir, outputDir, backfillOptions{
+		inputFormat:        "plaintext",
+		mappingConfig:      mappingConfig,
+		namingScheme:       "legacy",
+		blockDuration:      2 * time.Hour,
+		maxBufferedSamples: 5000,
+	}))
+
+	samples := readSamples(t, outputDir)
+	require.Len(t, samples, 6)
+	for i, s := range samples {
+		server := i / 2
+		require.Equal(t, labels.FromStrings("__name__", "load", "server", fmt.Sprintf("s%d", server)), s.Labels)
+		if i%2 == 0 {
+			require.Equal(t, 1000*(now-3600), s.Timestamp)
+			require.Equal(t, float64(server), s.Value)
+		} else {
+			require.Equal(t, 1000*now, s.Timestamp)
+			require.Equal(t, float64(server+10), s.Value)
+		}
+	}
+}
+
+func TestBackfillRender(t *testing.T) {
+	now := time.Now().Unix()
+	now -= now % 60
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metrics/find":
+			switch r.URL.Query().Get("query") {
+			case "*":
+				fmt.Fprint(w, `[{"id": "servers", "leaf": 0}]`)
+			case "servers.*":
+				fmt.Fprint(w, `[{"id": "servers.s0", "leaf": 1}, {"id": "servers.s1", "leaf": 1}]`)
+			default:
+				fmt.Fprint(w, `[]`)
+			}
+		case "/render":
+			fmt.Fprintf(w, `[{"target": %q, "datapoints": [[1, %d], [null, %d], [2, %d]]}]`,
+				r.URL.Query().Get("target"), now-120, now-60, now)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	outputDir := t.TempDir()
+	opts := backfillOptions{
+		inputFormat:        "render",
+		renderConcurrency:  2,
+		namingScheme:       "legacy",
+		blockDuration:      2 * time.Hour,
+		maxBufferedSamples: 5000,
+	}
+	require.Error(t, backfill(server.URL, outputDir, opts))
+
+	opts.start, opts.end = time.Unix(now-3600, 0), time.Unix(now, 0)
+	require.NoError(t, backfill(server.URL, outputDir, opts))
+
+	require.Equal(t, []backfillSample{
+		{Timestamp: 1000 * (now - 120), Value: 1, Labels: labels.FromStrings("__name__", "servers_s0")},
+		{Timestamp: 1000 * now, Value: 2, Labels: labels.FromStrings("__name__", "servers_s0")},
+		{Timestamp: 1000 * (now - 120), Value: 1, Labels: labels.FromStrings("__name__", "servers_s1")},
+		{Timestamp: 1000 * now, Value: 2, Labels: labels.FromStrings("__name__", "servers_s1")},
+	}, readSamples(t, outputDir))
+}
+
+func TestBackfillCeres(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+
+	now := time.Now().Unix()
+	now -= now % 60
+	for i := range 2 {
+		dir := filepath.Join(inputDir, "servers", fmt.Sprintf("s%d", i), "load")
+		require.NoError(t, os.MkdirAll(dir, 0o777))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".ceres-node"), []byte(`{"timeStep": 60}`), 0o666))
+		var buf []byte
+		for _, v := range []float64{float64(i), math.NaN(), float64(i + 10)} {
+			buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(v))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d@60.slice", now-120)), buf, 0o666))
+	}
+
+	require.NoError(t, backfill(inputDir, outputDir, backfillOptions{
+		inputFormat:        "ceres",
+		namingScheme:       "legacy",
+		blockDuration:      2 * time.Hour,
+		maxBufferedSamples: 5000,
+	}))
+
+	require.Equal(t, []backfillSample{
+		{Timestamp: 1000 * (now - 120), Value: 0, Labels: labels.FromStrings("__name__", "servers_s0_load")},
+		{Timestamp: 1000 * now, Value: 10, Labels: labels.FromStrings("__name__", "servers_s0_load")},
+		{Timestamp: 1000 * (now - 120), Value: 1, Labels: labels.FromStrings("__name__", "servers_s1_load")},
+		{Timestamp: 1000 * now, Value: 11, Labels: labels.FromStrings("__name__", "servers_s1_load")},
+	}, readSamples(t, outputDir))
+}
+
+func TestBackfillTagged(t *testing.T) {
+	whisperDir := t.TempDir()
+	outputDir := t.TempDir()
+
+	retentions, err := whisper.ParseRetentionDefs("1m:1d")
+	require.NoError(t, err)
+	now := int(time.Now().Unix())
+	now -= now % 60
+	for i, name := range []string{
+		"disk.used;datacenter=dc1;server=web01.example",
+		// The invalid tag is left out, like in the exporter.
+		"disk.used;datacenter=dc2;name=other;server=web02",
+		"load;server=web01.example",
+	} {
+		hash := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+		dir := filepath.Join(whisperDir, "_tagged", hash[0:3], hash[3:6])
+		require.NoError(t, os.MkdirAll(dir, 0o777))
+		wsp, err := whisper.Create(filepath.Join(dir, strings.ReplaceAll(name, ".", "_DOT_")+".wsp"), retentions, whisper.Average, 0.5)
+		require.NoError(t, err)
+		require.NoError(t, wsp.Update(float64(i), now))
+		require.NoError(t, wsp.Close())
+	}
+
+	mappingConfig := filepath.Join(t.TempDir(), "mapping.yaml")
+	require.NoError(t, os.WriteFile(mappingConfig, []byte(`
+mappings:
+- match: disk.*
+  name: disk_${1}_bytes
+  labels:
+    datacenter: mapped
+`), 0o666))
+
+	require.NoError(t, backfill(whisperDir, outputDir, backfillOptions{
+		mappingConfig:      mappingConfig,
+		namingScheme:       "legacy",
+		blockDuration:      2 * time.Hour,
+		maxBufferedSamples: 5000,
+	}))
+
+	// Labels from the mapping take precedence over tags.
+	require.Equal(t, []backfillSample{
+		{Timestamp: 1000 * int64(now), Value: 0, Labels: labels.FromStrings("__name__", "disk_used_bytes", "datacenter", "mapped", "server", "web01.example")},
+		{Timestamp: 1000 * int64(now), Value: 1, Labels: labels.FromStrings("__name__", "disk_used_bytes", "datacenter", "mapped", "server", "web02")},
+		{Timestamp: 1000 * int64(now), Value: 2, Labels: labels.FromStrings("__name__", "load", "server", "web01.example")},
+	}, readSamples(t, outputDir))
+}
@@ -0,0 +1,275 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !aix && !windows
+// +build !aix,!windows
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+const (
+	// checkpointFile records the imports into an output directory that have
+	// completed, and the blocks that a running import has completed.
+	checkpointFile = "getool-checkpoint.json"
+	// stagingDir holds blocks until they are recorded in the checkpoint, so
+	// that an interrupted import never leaves unrecorded blocks behind.
+	stagingDir = ".getool-staging"
+)
+
+// checkpointBlock is a block window that has been completed. The ULID is
+// zero if the window had no samples.
+type checkpointBlock struct {
+	Start int64     `json:"start"`
+	ULID  ulid.ULID `json:"ulid"`
+}
+
+// importParams are the parameters that determine the samples an import
+// writes. An import can only be resumed with the same parameters, and is not
+// run again once it has completed. The mapping configuration is identified by
+// the SHA-256 hash of its content, so that changes to the file are noticed.
+type importParams struct {
+	Input         string         `json:"input"`
+	InputFormat   string         `json:"input_format"`
+	Archives      string         `json:"archives,omitempty"`
+	Filter        filterPatterns `json:"filter"`
+	Start         time.Time      `json:"start,omitzero"`
+	End           time.Time      `json:"end,omitzero"`
+	BlockDuration string         `json:"block_duration"`
+	MappingConfig string         `json:"mapping_config_sha256,omitempty"`
+	StrictMatch   bool           `json:"strict_match"`
+	NamingScheme  string         `json:"naming_scheme"`
+}
+
+func newImportParams(opts backfillOptions) (importParams, error) {
+	input := opts.input
+	if opts.inputFormat != "render" {
+		if abs, err := filepath.Abs(input); err == nil {
+			input = abs
+		}
+	}
+	var mappingConfig string
+	if opts.mappingConfig != "" {
+		data, err := os.ReadFile(opts.mappingConfig)
+		if err != nil {
+			return importParams{}, err
+		}
+		sum := sha256.Sum256(data)
+		mappingConfig = hex.EncodeToString(sum[:])
+	}
+	return importParams{
+		Input:         input,
+		InputFormat:   opts.inputFormat,
+		Archives:      opts.archives,
+		Filter:        opts.filter.patterns,
+		Start:         opts.start,
+		End:           opts.end,
+		BlockDuration: opts.blockDuration.String(),
+		MappingConfig: mappingConfig,
+		StrictMatch:   opts.strictMatch,
+		NamingScheme:  string(opts.namingScheme),
+	}, nil
+}
+
+// fields returns the JSON encoding of each parameter.
+func (p importParams) fields() (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	return fields, json.Unmarshal(data, &fields)
+}
+
+// differences returns the names of the parameters that differ from other.
+func (p importParams) differences(other importParams) ([]string, error) {
+	a, err := p.fields()
+	if err != nil {
+		return nil, err
+	}
+	b, err := other.fields()
+	if err != nil {
+		return nil, err
+	}
+	var diff []string
+	for k := range a {
+		if !bytes.Equal(a[k], b[k]) {
+			diff = append(diff, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			diff = append(diff, k)
+		}
+	}
+	sort.Strings(diff)
+	return diff, nil
+}
+
+// checkpoint is the progress of the imports into an output directory. Params
+// and Blocks belong to the running import, if any.
+type checkpoint struct {
+	Completed []importParams    `json:"completed,omitempty"`
+	Params    *importParams     `json:"params,omitempty"`
+	Blocks    []checkpointBlock `json:"blocks,omitempty"`
+
+	path string
+	done map[int64]ulid.ULID
+}
+
+// openCheckpoint returns the checkpoint of the output directory, and starts
+// an import with the given parameters in it. An import that was interrupted
+// is only continued with resume and the same parameters, in which case its
+// output is cleaned up first. An import that has completed is not run again.
+func openCheckpoint(outputDir string, params importParams, resume bool) (*checkpoint, error) {
+	cp := &checkpoint{
+		path: filepath.Join(outputDir, checkpointFile),
+		done: map[int64]ulid.ULID{},
+	}
+
+	data, err := os.ReadFile(cp.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, cp); err != nil {
+			return nil, fmt.Errorf("read checkpoint: %w", err)
+		}
+	}
+
+	for _, completed := range cp.Completed {
+		diff, err := params.differences(completed)
+		if err != nil {
+			return nil, err
+		}
+		if len(diff) == 0 {
+			return nil, fmt.Errorf("an import with the same parameters has already completed in %s", outputDir)
+		}
+	}
+
+	switch {
+	case cp.Params == nil && resume:
+		return nil, fmt.Errorf("no import to resume in %s", outputDir)
+	case cp.Params == nil:
+		cp.Params = &params
+		return cp, cp.save()
+	case !resume:
+		return nil, fmt.Errorf("%s records an interrupted import; use --resume to continue it, or remove the file to start over", cp.path)
+	}
+
+	diff, err := params.differences(*cp.Params)
+	if err != nil {
+		return nil, err
+	}
+	if len(diff) > 0 {
+		return nil, fmt.Errorf("the import to resume was started with a different %s", strings.Join(diff, ", "))
+	}
+	for _, b := range cp.Blocks {
+		cp.done[b.Start] = b.ULID
+	}
+	return cp, cp.cleanup(outputDir)
+}
+
+// cleanup removes the partial output of an interrupted import. Staged blocks
+// that were recorded are moved into the output directory, all others are
+// removed along with the temporary files of the import.
+func (cp *checkpoint) cleanup(outputDir string) error {
+	recorded := make(map[ulid.ULID]struct{}, len(cp.done))
+	for _, id := range cp.done {
+		recorded[id] = struct{}{}
+	}
+
+	staged, err := os.ReadDir(filepath.Join(outputDir, stagingDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, e := range staged {
+		path := filepath.Join(outputDir, stagingDir, e.Name())
+		id, err := ulid.ParseStrict(e.Name())
+		if _, ok := recorded[id]; err == nil && ok {
+			if err := os.Rename(path, filepath.Join(outputDir, e.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".spill-") {
+			if err := os.RemoveAll(filepath.Join(outputDir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// completed returns whether the block window starting at the given timestamp
+// has been completed.
+func (cp *checkpoint) completed(start int64) bool {
+	_, ok := cp.done[start]
+	return ok
+}
+
+// add records that the block window starting at the given timestamp has been
+// completed.
+func (cp *checkpoint) add(start int64, id ulid.ULID) error {
+	cp.Blocks = append(cp.Blocks, checkpointBlock{Start: start, ULID: id})
+	cp.done[start] = id
+	return cp.save()
+}
+
+// complete records that the running import has completed. Its blocks are no
+// longer needed, as it cannot be resumed.
+func (cp *checkpoint) complete() error {
+	cp.Completed = append(cp.Completed, *cp.Params)
+	cp.Params = nil
+	cp.Blocks = nil
+	return cp.save()
+}
+
+// save replaces the checkpoint file, so that it is never left half written.
+func (cp *checkpoint) save() error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := cp.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o666); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	return os.Rename(tmp, cp.path)
+}
@@ -15,11 +15,18 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/prometheus/common/version"
+
+	"github.com/prometheus/graphite_exporter/collector"
 )
 
 func main() {
@@ -31,19 +38,201 @@ func main() {
 
 	importCmd := app.Command("create-blocks", "Import samples from OpenMetrics input and produce TSDB blocks. Please refer to the exporter docs for more details.")
 	// TODO(aSquare14): add flag to set default block duration
-	importFilePath := importCmd.Arg("whisper directory", "Directory of the whisper database.").Required().String()
+	importFilePath := importCmd.Arg("input", "Directory of the whisper or ceres database, file or directory of plaintext dumps, or URL of the Graphite API.").Required().String()
 	importDBPath := importCmd.Arg("output directory", "Output directory for generated blocks.").Default(defaultDBPath).String()
 	importHumanReadable := importCmd.Flag("human-readable", "Print human readable values.").Short('r').Bool()
 	importBlockDuration := importCmd.Flag("block-duration", "TSDB block duration.").Default("2h").Duration()
 	importMappingConfig := importCmd.Flag("graphite.mapping-config", "Metric mapping configuration file name.").Default("").String()
 	importStrictMatch := importCmd.Flag("graphite.mapping-strict-match", "Only import metrics that match the mapping configuration.").Bool()
+	importNamingScheme := importCmd.Flag("graphite.naming-scheme", "How Graphite paths are turned into metric names. Valid options are \"legacy\", \"underscores\", \"dots\", \"values\" and \"utf8\".").Default(string(collector.NamingSchemeLegacy)).Enum(collector.NamingSchemes...)
+	importInputFormat := importCmd.Flag("input-format", "Format of the input. \"whisper\" reads a whisper database. \"ceres\" reads a ceres database. \"plaintext\" reads files with Graphite plaintext protocol lines, optionally compressed with gzip; all their points are held in memory, regardless of --max-buffered-samples. \"render\" reads from the Graphite HTTP API, and requires --start and --end.").Default("whisper").Enum("whisper", "ceres", "plaintext", "render")
+	importRenderConcurrency := importCmd.Flag("render.concurrency", "Maximum number of concurrent requests to the Graphite API.").Default("4").Int()
+	importRenderRateLimit := importCmd.Flag("render.rate-limit", "Maximum number of requests per second to the Graphite API. Unlimited if 0.").Default("0").Float64()
+	importArchives := importCmd.Flag("whisper.archives", "Which archives of a whisper file to read. \"finest\" reads each time range from the finest archive that covers it. \"single\" reads all points from the one archive that covers the whole range, like Graphite does.").Default("finest").Enum("finest", "single")
+	importStart := importCmd.Flag("start", "Only import samples at or after this time, as RFC 3339 or Unix timestamp.").Default("").String()
+	importEnd := importCmd.Flag("end", "Only import samples at or before this time, as RFC 3339 or Unix timestamp.").Default("").String()
+	importInclude := importCmd.Flag("include", "Only import metrics whose path matches this Graphite glob. May be repeated.").Strings()
+	importIncludeRegex := importCmd.Flag("include-regex", "Only import metrics whose path matches this regular expression. May be repeated.").Strings()
+	importExclude := importCmd.Flag("exclude", "Do not import metrics whose path matches this Graphite glob. May be repeated.").Strings()
+	importExcludeRegex := importCmd.Flag("exclude-regex", "Do not import metrics whose path matches this regular expression. May be repeated.").Strings()
+	importWorkers := importCmd.Flag("workers", "Number of metrics to read and append in parallel.").Default(strconv.Itoa(runtime.GOMAXPROCS(0))).Int()
+	importMaxSamples := importCmd.Flag("max-buffered-samples", "Maximum number of samples buffered before they are written to temporary files while reading, and lined up in appenders while a block is built. This does not limit the memory used by the block being built, which is held in memory until it is written.").Default("1000000").Int()
+	importResume := importCmd.Flag("resume", "Continue an interrupted import into the same output directory, skipping the blocks it completed. The arguments must be the same as for the interrupted import.").Bool()
+	importProgressInterval := importCmd.Flag("progress-interval", "How often to report progress on standard error. Disabled if 0.").Default("10s").Duration()
+
+	mappingCmd := app.Command("mapping", "Work with metric mapping configurations.")
+	mappingTestCmd := mappingCmd.Command("test", "Map Graphite plaintext lines and print the resulting Prometheus series. Fails if series conflict or the output differs from the expected output.")
+	mappingTestFiles := mappingTestCmd.Arg("input file", "Files with Graphite plaintext lines. Reads from standard input if none are given.").Strings()
+	mappingTestMappingConfig := mappingTestCmd.Flag("graphite.mapping-config", "Metric mapping configuration file name.").Default("").String()
+	mappingTestStrictMatch := mappingTestCmd.Flag("graphite.mapping-strict-match", "Drop metrics that do not match the mapping configuration.").Bool()
+	mappingTestFormat := mappingTestCmd.Flag("format", "Output format.").Default("text").Enum("text", "json")
+	mappingTestExpected := mappingTestCmd.Flag("expected", "File with the expected output to compare against.").Default("").String()
+
+	mappingSuggestCmd := mappingCmd.Command("suggest", "Propose a metric mapping configuration for the metrics in a whisper database. Prints the mapping to standard output and a coverage report to standard error.")
+	mappingSuggestPath := mappingSuggestCmd.Arg("whisper directory", "Directory of the whisper database.").Required().String()
+	mappingSuggestMinVariants := mappingSuggestCmd.Flag("min-variants", "Number of distinct values in a path segment, all else being equal, above which the segment becomes a label.").Default("3").Int()
 
 	parsedCmd := kingpin.MustParse(app.Parse(os.Args[1:]))
 
 	switch parsedCmd {
 	case importCmd.FullCommand():
-		os.Exit(checkErr(backfillWhisper(*importFilePath, *importDBPath, *importMappingConfig, *importStrictMatch, *importHumanReadable, *importBlockDuration)))
+		filter, err := newMetricFilter(*importInclude, *importIncludeRegex, *importExclude, *importExcludeRegex)
+		if err != nil {
+			os.Exit(checkErr(err))
+		}
+		start, err := parseTime(*importStart)
+		if err != nil {
+			os.Exit(checkErr(fmt.Errorf("invalid start: %w", err)))
+		}
+		end, err := parseTime(*importEnd)
+		if err != nil {
+			os.Exit(checkErr(fmt.Errorf("invalid end: %w", err)))
+		}
+		os.Exit(checkErr(backfillWhisper(*importFilePath, *importDBPath, backfillOptions{
+			start:              start,
+			end:                end,
+			filter:             filter,
+			mappingConfig:      *importMappingConfig,
+			strictMatch:        *importStrictMatch,
+			namingScheme:       collector.NamingScheme(*importNamingScheme),
+			humanReadable:      *importHumanReadable,
+			blockDuration:      *importBlockDuration,
+			inputFormat:        *importInputFormat,
+			archives:           *importArchives,
+			renderConcurrency:  *importRenderConcurrency,
+			renderRateLimit:    *importRenderRateLimit,
+			workers:            *importWorkers,
+			maxBufferedSamples: *importMaxSamples,
+			progressInterval:   *importProgressInterval,
+			resume:             *importResume,
+		})))
+	case mappingTestCmd.FullCommand():
+		os.Exit(checkErr(mappingTest(*mappingTestFiles, *mappingTestMappingConfig, *mappingTestStrictMatch, *mappingTestFormat, *mappingTestExpected)))
+	case mappingSuggestCmd.FullCommand():
+		os.Exit(checkErr(mappingSuggest(*mappingSuggestPath, *mappingSuggestMinVariants)))
+	}
+}
+
+// backfillOptions are the options of the create-blocks command.
+type backfillOptions struct {
+	// start and end limit the samples that are imported, if not zero.
+	start, end    time.Time
+	filter        metricFilter
+	mappingConfig string
+	strictMatch   bool
+	namingScheme  collector.NamingScheme
+	humanReadable bool
+	blockDuration time.Duration
+	// inputFormat is the format of the input, "whisper", "ceres",
+	// "plaintext" or "render".
+	inputFormat string
+	// archives selects the archives of whisper files to read from.
+	archives string
+	// renderConcurrency and renderRateLimit limit the requests to the
+	// Graphite API.
+	renderConcurrency int
+	renderRateLimit   float64
+	// workers is the number of metrics read and appended in parallel.
+	workers int
+	// maxBufferedSamples limits the samples buffered before they are spilled
+	// to temporary files, and the samples lined up in appenders.
+	maxBufferedSamples int
+	// input is the path or URL the samples are read from.
+	input string
+	// progressInterval is how often progress is reported, if at all.
+	progressInterval time.Duration
+	// resume continues the import recorded in the checkpoint of the output
+	// directory.
+	resume bool
+}
+
+// metricFilter selects metrics by their Graphite path.
+type metricFilter struct {
+	include, exclude []*regexp.Regexp
+	// patterns are the patterns the filter was created from.
+	patterns filterPatterns
+}
+
+// filterPatterns are the globs and regular expressions of a metricFilter.
+type filterPatterns struct {
+	Include      []string `json:"include,omitempty"`
+	IncludeRegex []string `json:"include_regex,omitempty"`
+	Exclude      []string `json:"exclude,omitempty"`
+	ExcludeRegex []string `json:"exclude_regex,omitempty"`
+}
+
+func newMetricFilter(includeGlobs, includeRegexps, excludeGlobs, excludeRegexps []string) (metricFilter, error) {
+	var (
+		f = metricFilter{patterns: filterPatterns{
+			Include:      includeGlobs,
+			IncludeRegex: includeRegexps,
+			Exclude:      excludeGlobs,
+			ExcludeRegex: excludeRegexps,
+		}}
+		err error
+	)
+	if f.include, err = compilePatterns(includeGlobs, includeRegexps); err != nil {
+		return f, err
+	}
+	if f.exclude, err = compilePatterns(excludeGlobs, excludeRegexps); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+func compilePatterns(globs, regexps []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(globs)+len(regexps))
+	for _, g := range globs {
+		re, err := collector.GlobToRegexp(g)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	for _, r := range regexps {
+		re, err := regexp.Compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", r, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// matches reports whether a metric matches any include pattern, or there are
+// none, and no exclude pattern.
+func (f metricFilter) matches(metric string) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(metric) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(metric) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTime parses an RFC 3339 time or a Unix timestamp in seconds. It returns
+// the zero time for an empty string.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	ts, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse %q as RFC 3339 time or Unix timestamp", s)
 	}
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(frac*1e9)), nil
 }
 
 func checkErr(err error) int {
@@ -16,6 +16,9 @@ package main
 import (
 	"os"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -33,3 +36,42 @@ func TestMain(m *testing.M) {
 
 	os.Exit(m.Run())
 }
+
+func TestParseTime(t *testing.T) {
+	for in, expected := range map[string]time.Time{
+		"":                          {},
+		"1700000000":                time.Unix(1700000000, 0),
+		"1700000000.5":              time.Unix(1700000000, 5e8),
+		"2023-11-14T22:13:20Z":      time.Unix(1700000000, 0),
+		"2023-11-14T23:13:20+01:00": time.Unix(1700000000, 0),
+	} {
+		actual, err := parseTime(in)
+		require.NoError(t, err, in)
+		require.True(t, expected.Equal(actual), "%s: %s", in, actual)
+	}
+
+	_, err := parseTime("yesterday")
+	require.EqualError(t, err, `cannot parse "yesterday" as RFC 3339 time or Unix timestamp`)
+}
+
+func TestMetricFilter(t *testing.T) {
+	f, err := newMetricFilter([]string{"servers.web-*.cpu", "servers.db-*.*"}, nil, nil, []string{`\.idle$`})
+	require.NoError(t, err)
+	for metric, expected := range map[string]bool{
+		"servers.web-1.cpu":      true,
+		"servers.web-1.memory":   false,
+		"servers.db-1.disk":      true,
+		"servers.db-1.idle":      false,
+		"servers.web-1.cpu.user": false,
+	} {
+		require.Equal(t, expected, f.matches(metric), metric)
+	}
+
+	f, err = newMetricFilter(nil, nil, []string{"*.test.*"}, nil)
+	require.NoError(t, err)
+	require.True(t, f.matches("prod.web.requests"))
+	require.False(t, f.matches("prod.test.requests"))
+
+	_, err = newMetricFilter(nil, []string{"("}, nil, nil)
+	require.Error(t, err)
+}
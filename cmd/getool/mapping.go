@@ -0,0 +1,240 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+
+	"github.com/prometheus/graphite_exporter/collector"
+)
+
+// mappedSeries is the outcome of mapping the last sample seen for one
+// Graphite metric.
+type mappedSeries struct {
+	OriginalName string            `json:"original_name"`
+	Dropped      bool              `json:"dropped,omitempty"`
+	Name         string            `json:"name,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Type         string            `json:"type,omitempty"`
+	Value        string            `json:"value,omitempty"`
+	Timestamp    int64             `json:"timestamp,omitempty"`
+}
+
+func (s mappedSeries) series() string {
+	m := model.Metric{model.MetricNameLabel: model.LabelValue(s.Name)}
+	for k, v := range s.Labels {
+		m[model.LabelName(k)] = model.LabelValue(v)
+	}
+	return m.String()
+}
+
+func mappingTest(inputFiles []string, mappingConfig string, strictMatch bool, format, expectedFile string) error {
+	c := collector.NewGraphiteCollector(promslog.NewNopLogger(), strictMatch, 0)
+	metricMapper := &mapper.MetricMapper{}
+	if mappingConfig != "" {
+		if err := c.LoadMappingConfig(metricMapper, mappingConfig); err != nil {
+			return fmt.Errorf("loading metric mapping config: %w", err)
+		}
+	}
+	c.SetMapper(metricMapper)
+
+	// Like the exporter, keep only the last sample for each Graphite metric.
+	series := map[string]mappedSeries{}
+	if len(inputFiles) == 0 {
+		inputFiles = []string{"-"}
+	}
+	for _, f := range inputFiles {
+		err := func() error {
+			var in io.Reader = os.Stdin
+			if f != "-" {
+				file, err := os.Open(f)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				in = file
+			}
+
+			scanner := bufio.NewScanner(in)
+			for n := 1; scanner.Scan(); n++ {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" {
+					continue
+				}
+				sample, err := c.ParseLine(line)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s:%d: skipping line: %v\n", f, n, err)
+					continue
+				}
+				if sample == nil {
+					originalName := strings.Split(line, " ")[0]
+					series[originalName] = mappedSeries{OriginalName: originalName, Dropped: true}
+					continue
+				}
+				series[sample.OriginalName] = mappedSeries{
+					OriginalName: sample.OriginalName,
+					Name:         sample.Name,
+					Labels:       sample.Labels,
+					Type:         strings.ToLower(sample.Type.ToDTO().String()),
+					Value:        strconv.FormatFloat(sample.Value, 'g', -1, 64),
+					Timestamp:    sample.Timestamp.UnixMilli(),
+				}
+			}
+			return scanner.Err()
+		}()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", f, err)
+		}
+	}
+
+	result := make([]mappedSeries, 0, len(series))
+	for _, s := range series {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].OriginalName < result[j].OriginalName })
+
+	var buf bytes.Buffer
+	switch format {
+	case "json":
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	default:
+		for _, s := range result {
+			if s.Dropped {
+				fmt.Fprintf(&buf, "%s => dropped\n", s.OriginalName)
+				continue
+			}
+			fmt.Fprintf(&buf, "%s => %s %s\n", s.OriginalName, s.series(), s.Value)
+		}
+	}
+	if _, err := os.Stdout.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	errs := mappingConflicts(result)
+	if expectedFile != "" {
+		expected, err := os.ReadFile(expectedFile)
+		if err != nil {
+			return fmt.Errorf("reading expected output: %w", err)
+		}
+		if diff := diffLines(string(expected), buf.String()); diff != "" {
+			errs = append(errs, fmt.Errorf("output differs from %s:\n%s", expectedFile, diff))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// mappingConflicts returns an error for every metric name that is exposed
+// with more than one type or label name set, and for every series that more
+// than one Graphite metric maps to.
+func mappingConflicts(result []mappedSeries) []error {
+	var errs []error
+
+	types := map[string]map[string][]string{}
+	labelNames := map[string]map[string][]string{}
+	sources := map[string][]string{}
+	var names []string
+	for _, s := range result {
+		if s.Dropped {
+			continue
+		}
+		if _, ok := types[s.Name]; !ok {
+			names = append(names, s.Name)
+			types[s.Name] = map[string][]string{}
+			labelNames[s.Name] = map[string][]string{}
+		}
+		types[s.Name][s.Type] = append(types[s.Name][s.Type], s.OriginalName)
+
+		keys := make([]string, 0, len(s.Labels))
+		for k := range s.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		ln := "[" + strings.Join(keys, ", ") + "]"
+		labelNames[s.Name][ln] = append(labelNames[s.Name][ln], s.OriginalName)
+
+		sources[s.series()] = append(sources[s.series()], s.OriginalName)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if len(types[name]) > 1 {
+			errs = append(errs, fmt.Errorf("metric %s has conflicting types: %s", name, describeSources(types[name])))
+		}
+		if len(labelNames[name]) > 1 {
+			errs = append(errs, fmt.Errorf("metric %s has conflicting label names: %s", name, describeSources(labelNames[name])))
+		}
+	}
+
+	keys := make([]string, 0, len(sources))
+	for k := range sources {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if len(sources[k]) > 1 {
+			errs = append(errs, fmt.Errorf("series %s is produced by multiple metrics: %s", k, strings.Join(sources[k], ", ")))
+		}
+	}
+	return errs
+}
+
+func describeSources(m map[string][]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s (from %s)", k, m[k][0]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// diffLines describes the first line in which actual differs from expected,
+// or returns an empty string if they are equal.
+func diffLines(expected, actual string) string {
+	e := strings.Split(expected, "\n")
+	a := strings.Split(actual, "\n")
+	for i := 0; i < len(e) || i < len(a); i++ {
+		var el, al string
+		if i < len(e) {
+			el = e[i]
+		}
+		if i < len(a) {
+			al = a[i]
+		}
+		if el != al || i >= len(e) || i >= len(a) {
+			return fmt.Sprintf("line %d:\n- %s\n+ %s", i+1, el, al)
+		}
+	}
+	return ""
+}
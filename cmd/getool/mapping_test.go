@@ -0,0 +1,143 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMappingTest(t *testing.T) {
+	mappingConfig := `
+mappings:
+- match: test.dispatcher.*.*.*
+  name: dispatcher_events_total
+  labels:
+    action: $2
+    outcome: $3
+    processor: $1
+- match: test.drop.*
+  name: dropped
+  action: drop
+- match: test.requests.*
+  name: requests_total
+  cumulative: true
+  labels:
+    host: $1`
+
+	for _, tt := range []struct {
+		name     string
+		input    string
+		expected string
+		golden   string
+		fail     bool
+	}{
+		{
+			name: "mapped",
+			input: `test.dispatcher.FooProcessor.send.success 1 1700000000
+test.dispatcher.FooProcessor.send.success 2 1700000010
+test.drop.me 3 1700000000
+test.web-server.foo;env=prod 4 1700000000
+`,
+			expected: `test.dispatcher.FooProcessor.send.success => dispatcher_events_total{action="send", outcome="success", processor="FooProcessor"} 2
+test.drop.me => dropped
+test.web-server.foo;env=prod => test_web_server_foo{env="prod"} 4
+`,
+		},
+		{
+			name: "conflicting label names",
+			input: `foo.bar 1 1700000000
+foo.bar;env=prod 2 1700000000
+`,
+			expected: `foo.bar => foo_bar 1
+foo.bar;env=prod => foo_bar{env="prod"} 2
+`,
+			fail: true,
+		},
+		{
+			name: "conflicting types",
+			input: `test.requests.a 1 1700000000
+requests_total;host=b 2 1700000000
+`,
+			expected: `requests_total;host=b => requests_total{host="b"} 2
+test.requests.a => requests_total{host="a"} 1
+`,
+			fail: true,
+		},
+		{
+			name: "duplicate series",
+			input: `test.web-server.foo 1 1700000000
+test.web_server.foo 2 1700000000
+`,
+			expected: `test.web-server.foo => test_web_server_foo 1
+test.web_server.foo => test_web_server_foo 2
+`,
+			fail: true,
+		},
+		{
+			name:  "matching golden file",
+			input: "foo.bar 1 1700000000\n",
+			expected: `foo.bar => foo_bar 1
+`,
+			golden: "foo.bar => foo_bar 1\n",
+		},
+		{
+			name:  "differing golden file",
+			input: "foo.bar 1 1700000000\n",
+			expected: `foo.bar => foo_bar 1
+`,
+			golden: "foo.bar => foo_bar 2\n",
+			fail:   true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfgFile := filepath.Join(tmpDir, "mapping.yaml")
+			require.NoError(t, os.WriteFile(cfgFile, []byte(mappingConfig), 0o644))
+			inputFile := filepath.Join(tmpDir, "input.txt")
+			require.NoError(t, os.WriteFile(inputFile, []byte(tt.input), 0o644))
+
+			arguments := []string{
+				"-test.main",
+				"mapping", "test",
+				"--graphite.mapping-config", cfgFile,
+			}
+			if tt.golden != "" {
+				goldenFile := filepath.Join(tmpDir, "expected.txt")
+				require.NoError(t, os.WriteFile(goldenFile, []byte(tt.golden), 0o644))
+				arguments = append(arguments, "--expected", goldenFile)
+			}
+			arguments = append(arguments, inputFile)
+
+			var stdout, stderr bytes.Buffer
+			cmd := exec.Command(testPath, arguments...)
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			err := cmd.Run()
+			t.Log(stderr.String())
+
+			if tt.fail {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.expected, stdout.String())
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !aix && !windows
+// +build !aix,!windows
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/graphite_exporter/reader"
+)
+
+// spillRecordSize is the size of a spilled sample: the index of its series
+// followed by its timestamp and value.
+const spillRecordSize = 4 + 8 + 8
+
+// spilledSample is a sample read back from a spill file.
+type spilledSample struct {
+	series    uint32
+	timestamp int64
+	value     float64
+}
+
+// spill keeps the samples of each block in a file until the block is built,
+// so that every metric only needs to be read once. Samples are buffered in
+// memory and appended to the files whenever the buffer is full.
+type spill struct {
+	mu       sync.Mutex
+	dir      string
+	limit    int
+	buffers  map[int64][]byte
+	buffered int
+	blocks   map[int64]struct{}
+}
+
+func newSpill(dir string, limit int) *spill {
+	return &spill{
+		dir:     dir,
+		limit:   limit,
+		buffers: map[int64][]byte{},
+		blocks:  map[int64]struct{}{},
+	}
+}
+
+func (s *spill) path(block int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d.spill", block))
+}
+
+// add spills the points of a series that belong to the block starting at
+// the given timestamp.
+func (s *spill) add(block int64, series uint32, points []reader.Point) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := s.buffers[block]
+	for _, p := range points {
+		buf = binary.LittleEndian.AppendUint32(buf, series)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(p.Timestamp))
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(p.Value))
+	}
+	s.buffers[block] = buf
+	s.blocks[block] = struct{}{}
+	s.buffered += len(points)
+	if s.buffered < s.limit {
+		return nil
+	}
+	return s.flushLocked()
+}
+
+// flush writes all buffered samples to the spill files.
+func (s *spill) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flushLocked()
+}
+
+func (s *spill) flushLocked() error {
+	for block, buf := range s.buffers {
+		f, err := os.OpenFile(s.path(block), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(buf)
+		if err := errors.Join(err, f.Close()); err != nil {
+			return fmt.Errorf("spill samples: %w", err)
+		}
+		delete(s.buffers, block)
+	}
+	s.buffered = 0
+	return nil
+}
+
+// blockStarts returns the start of each block that has samples, in order.
+func (s *spill) blockStarts() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	starts := make([]int64, 0, len(s.blocks))
+	for b := range s.blocks {
+		starts = append(starts, b)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	return starts
+}
+
+// read calls fn for each sample spilled for a block, in the order in which
+// they were added. It must only be called after flush.
+func (s *spill) read(block int64, fn func(spilledSample) error) error {
+	f, err := os.Open(s.path(block))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var rec [spillRecordSize]byte
+	for {
+		if _, err := io.ReadFull(r, rec[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("read spilled samples: %w", err)
+		}
+		err := fn(spilledSample{
+			series:    binary.LittleEndian.Uint32(rec[0:]),
+			timestamp: int64(binary.LittleEndian.Uint64(rec[4:])),
+			value:     math.Float64frombits(binary.LittleEndian.Uint64(rec[12:])),
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// remove deletes the spill file of a block once it has been built.
+func (s *spill) remove(block int64) error {
+	return os.Remove(s.path(block))
+}
@@ -0,0 +1,304 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !aix && !windows
+// +build !aix,!windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+
+	"github.com/prometheus/graphite_exporter/reader"
+)
+
+var (
+	numberSegment   = regexp.MustCompile(`^[0-9]+$`)
+	idSegment       = regexp.MustCompile(`^[0-9a-fA-F][0-9a-fA-F-]{10,}[0-9a-fA-F]$`)
+	hostSegment     = regexp.MustCompile(`^[a-zA-Z0-9]+(-[a-zA-Z0-9]+)+$|^[a-zA-Z0-9]+(_[a-zA-Z0-9]+){2,}$`)
+	indexedSegment  = regexp.MustCompile(`^([a-zA-Z]+)[0-9]+$`)
+	globSegment     = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_\-]*$`)
+	invalidNameChar = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// segmentLabel guesses a label name for a variable path segment from its
+// value. It returns an empty string if the segment does not look variable.
+func segmentLabel(segment string) string {
+	switch {
+	case numberSegment.MatchString(segment):
+		return "index"
+	case idSegment.MatchString(segment) && strings.ContainsAny(segment, "0123456789"):
+		return "id"
+	case hostSegment.MatchString(segment) && strings.ContainsAny(segment, "0123456789"):
+		return "host"
+	case indexedSegment.MatchString(segment):
+		return strings.ToLower(indexedSegment.FindStringSubmatch(segment)[1])
+	}
+	return ""
+}
+
+// suggestedMapping is a proposed glob mapping and the metrics it was built
+// from.
+type suggestedMapping struct {
+	match   []string
+	name    string
+	labels  []string
+	metrics []string
+}
+
+// suggestMappings clusters Graphite metric paths by shape. Segments that look
+// like numbers, IDs, hostnames or indexed names become wildcards, as do
+// positions in which at least minVariants distinct values occur between
+// otherwise identical paths.
+func suggestMappings(metrics []string, minVariants int) []suggestedMapping {
+	patterns := make([][]string, len(metrics))
+	for i, m := range metrics {
+		segments := strings.Split(m, ".")
+		patterns[i] = make([]string, len(segments))
+		for j, s := range segments {
+			if segmentLabel(s) != "" {
+				s = "*"
+			}
+			patterns[i][j] = s
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+
+		variants := map[string]map[string]struct{}{}
+		for _, p := range patterns {
+			for j, s := range p {
+				if s == "*" {
+					continue
+				}
+				k := generalize(p, j)
+				if variants[k] == nil {
+					variants[k] = map[string]struct{}{}
+				}
+				variants[k][s] = struct{}{}
+			}
+		}
+
+		for _, p := range patterns {
+			for j, s := range p {
+				if s == "*" || len(variants[generalize(p, j)]) < minVariants {
+					continue
+				}
+				// Keep at least one literal segment to derive the metric name from.
+				if fixedSegments(p) < 2 {
+					continue
+				}
+				p[j] = "*"
+				changed = true
+			}
+		}
+	}
+
+	groups := map[string]*suggestedMapping{}
+	for i, p := range patterns {
+		k := strings.Join(p, ".")
+		if groups[k] == nil {
+			groups[k] = &suggestedMapping{match: p}
+		}
+		groups[k].metrics = append(groups[k].metrics, metrics[i])
+	}
+
+	var result []suggestedMapping
+	names := map[string]int{}
+	for _, g := range groups {
+		if !g.valid() {
+			continue
+		}
+		g.name, g.labels = g.nameAndLabels()
+		result = append(result, *g)
+	}
+	// More specific mappings go first, as the first matching rule wins.
+	sort.Slice(result, func(i, j int) bool {
+		wi, wj := len(result[i].labels), len(result[j].labels)
+		if wi != wj {
+			return wi < wj
+		}
+		return result[i].Match() < result[j].Match()
+	})
+	for i := range result {
+		names[result[i].name]++
+		if n := names[result[i].name]; n > 1 {
+			result[i].name = fmt.Sprintf("%s_%d", result[i].name, n)
+		}
+	}
+	return result
+}
+
+func generalize(pattern []string, i int) string {
+	p := make([]string, len(pattern))
+	copy(p, pattern)
+	p[i] = "*"
+	return strings.Join(p, ".")
+}
+
+func fixedSegments(pattern []string) int {
+	n := 0
+	for _, s := range pattern {
+		if s != "*" {
+			n++
+		}
+	}
+	return n
+}
+
+// Match returns the glob expression of the mapping.
+func (m suggestedMapping) Match() string {
+	return strings.Join(m.match, ".")
+}
+
+// valid reports whether the mapping has at least one wildcard and can be
+// expressed as a statsd_exporter glob.
+func (m suggestedMapping) valid() bool {
+	if fixedSegments(m.match) == len(m.match) || fixedSegments(m.match) == 0 {
+		return false
+	}
+	for i, s := range m.match {
+		if s == "*" {
+			continue
+		}
+		if !globSegment.MatchString(s) || (i == 0 && numberSegment.MatchString(s[:1])) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m suggestedMapping) nameAndLabels() (string, []string) {
+	var (
+		fixed  []string
+		labels []string
+		seen   = map[string]int{}
+	)
+	for i, s := range m.match {
+		if s != "*" {
+			fixed = append(fixed, s)
+			continue
+		}
+
+		label := ""
+		for _, metric := range m.metrics {
+			l := segmentLabel(strings.Split(metric, ".")[i])
+			if label != "" && l != label {
+				label = ""
+				break
+			}
+			label = l
+		}
+		if label == "" && i > 0 && m.match[i-1] != "*" {
+			label = m.match[i-1]
+		}
+		label = strings.Trim(strings.ToLower(invalidNameChar.ReplaceAllString(label, "_")), "_")
+		if len(label) < 2 || numberSegment.MatchString(label[:1]) {
+			label = "label"
+		}
+		seen[label]++
+		if seen[label] > 1 {
+			label = fmt.Sprintf("%s%d", label, seen[label])
+		}
+		labels = append(labels, label)
+	}
+
+	name := invalidNameChar.ReplaceAllString(strings.Join(fixed, "_"), "_")
+	if numberSegment.MatchString(name[:1]) {
+		name = "graphite_" + name
+	}
+	return name, labels
+}
+
+func writeMappings(w io.Writer, mappings []suggestedMapping) {
+	fmt.Fprintln(w, "mappings:")
+	for _, m := range mappings {
+		fmt.Fprintf(w, "- match: '%s'\n", m.Match())
+		fmt.Fprintf(w, "  name: %s\n", m.name)
+		fmt.Fprintln(w, "  labels:")
+		for i, l := range m.labels {
+			fmt.Fprintf(w, "    %s: $%d\n", l, i+1)
+		}
+	}
+}
+
+func mappingSuggest(inputDir string, minVariants int) error {
+	series, err := reader.NewReader(inputDir).Metrics()
+	if err != nil {
+		return fmt.Errorf("listing metrics: %w", err)
+	}
+	// Mappings apply to the paths of tagged series, the tags become labels.
+	metrics := make([]string, 0, len(series))
+	for _, s := range series {
+		path, _, _ := strings.Cut(s, ";")
+		metrics = append(metrics, path)
+	}
+	sort.Strings(metrics)
+	metrics = slices.Compact(metrics)
+
+	mappings := suggestMappings(metrics, minVariants)
+
+	var config strings.Builder
+	writeMappings(&config, mappings)
+
+	// Check the suggestion the same way the exporter would load it, and
+	// compute the coverage from the actual matches.
+	metricMapper := &mapper.MetricMapper{Logger: promslog.NewNopLogger()}
+	if err := metricMapper.InitFromYAMLString(config.String()); err != nil {
+		return fmt.Errorf("generated mapping is invalid: %w", err)
+	}
+	matches := map[string]int{}
+	var unmapped []string
+	for _, m := range metrics {
+		mapping, _, present := metricMapper.GetMapping(m, mapper.MetricTypeGauge)
+		if !present {
+			unmapped = append(unmapped, m)
+			continue
+		}
+		matches[mapping.Match]++
+	}
+
+	fmt.Print(config.String())
+
+	tw := tabwriter.NewWriter(os.Stderr, 13, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MATCH\tNAME\tMETRICS")
+	for _, m := range mappings {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", m.Match(), m.name, matches[m.Match()])
+	}
+	tw.Flush()
+
+	covered := len(metrics) - len(unmapped)
+	fmt.Fprintf(os.Stderr, "\n%d of %d metrics (%.1f%%) are matched by %d mappings.\n", covered, len(metrics), 100*float64(covered)/float64(max(len(metrics), 1)), len(mappings))
+	if len(unmapped) > 0 {
+		fmt.Fprintln(os.Stderr, "Unmapped metrics include:")
+		for i, m := range unmapped {
+			if i == 10 {
+				fmt.Fprintf(os.Stderr, "  ... and %d more\n", len(unmapped)-i)
+				break
+			}
+			fmt.Fprintf(os.Stderr, "  %s\n", m)
+		}
+	}
+	return nil
+}
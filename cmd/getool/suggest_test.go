@@ -0,0 +1,83 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !aix && !windows
+// +build !aix,!windows
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggestMappings(t *testing.T) {
+	var metrics []string
+	for _, host := range []string{"web-01", "web-02", "db-01"} {
+		for cpu := 0; cpu < 2; cpu++ {
+			for _, state := range []string{"idle", "user", "system"} {
+				metrics = append(metrics, fmt.Sprintf("servers.%s.cpu.cpu%d.%s", host, cpu, state))
+			}
+		}
+		metrics = append(metrics, fmt.Sprintf("servers.%s.memory.free", host))
+	}
+	metrics = append(metrics,
+		"rspamd.actions.add_header",
+		"rspamd.actions.greylist",
+		"rspamd.actions.reject",
+		"rspamd.connections",
+		"jobs.3f2a9c1e-1b2c-4d5e-8f90-123456789abc.duration",
+		"jobs.42.duration",
+	)
+
+	mappings := suggestMappings(metrics, 3)
+
+	var config strings.Builder
+	writeMappings(&config, mappings)
+	require.Equal(t, `mappings:
+- match: 'jobs.*.duration'
+  name: jobs_duration
+  labels:
+    jobs: $1
+- match: 'rspamd.actions.*'
+  name: rspamd_actions
+  labels:
+    actions: $1
+- match: 'servers.*.memory.free'
+  name: servers_memory_free
+  labels:
+    host: $1
+- match: 'servers.*.cpu.*.*'
+  name: servers_cpu
+  labels:
+    host: $1
+    cpu: $2
+    label: $3
+`, config.String())
+
+	metricMapper := &mapper.MetricMapper{Logger: promslog.NewNopLogger()}
+	require.NoError(t, metricMapper.InitFromYAMLString(config.String()))
+
+	mapping, labels, present := metricMapper.GetMapping("servers.web-02.cpu.cpu1.user", mapper.MetricTypeGauge)
+	require.True(t, present)
+	require.Equal(t, "servers_cpu", mapping.Name)
+	require.Equal(t, map[string]string{"host": "web-02", "cpu": "cpu1", "label": "user"}, map[string]string(labels))
+
+	_, _, present = metricMapper.GetMapping("rspamd.connections", mapper.MetricTypeGauge)
+	require.False(t, present)
+}
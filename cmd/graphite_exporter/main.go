@@ -17,11 +17,15 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/prometheus/client_golang/prometheus"
@@ -37,21 +41,66 @@ import (
 	"github.com/prometheus/statsd_exporter/pkg/mappercache/randomreplacement"
 
 	"github.com/prometheus/graphite_exporter/collector"
+	"github.com/prometheus/graphite_exporter/otlp"
+	"github.com/prometheus/graphite_exporter/relay"
+	"github.com/prometheus/graphite_exporter/remotewrite"
 )
 
 var (
 	metricsPath     = kingpin.Flag("web.telemetry-path", "Path under which to expose Prometheus metrics.").Default("/metrics").String()
+	openMetrics     = kingpin.Flag("web.enable-openmetrics", "Expose metrics in the OpenMetrics format to scrapers that request it. Required to expose the units of mapped metrics.").Bool()
 	graphiteAddress = kingpin.Flag("graphite.listen-address", "TCP and UDP address on which to accept samples.").Default(":9109").String()
 	mappingConfig   = kingpin.Flag("graphite.mapping-config", "Metric mapping configuration file name.").Default("").String()
 	sampleExpiry    = kingpin.Flag("graphite.sample-expiry", "How long a sample is valid for.").Default("5m").Duration()
 	strictMatch     = kingpin.Flag("graphite.mapping-strict-match", "Only store metrics that match the mapping configuration.").Bool()
+	namingScheme    = kingpin.Flag("graphite.naming-scheme", "How Graphite paths are turned into metric names. Valid options are \"legacy\", \"underscores\", \"dots\", \"values\" and \"utf8\".").Default(string(collector.NamingSchemeLegacy)).Enum(collector.NamingSchemes...)
+	consistency     = kingpin.Flag("graphite.label-consistency", "How to handle samples whose label names differ from the first sample with the same metric name. Valid options are \"off\", \"fill\" (add missing labels with empty values and remove others) and \"drop\".").Default(string(collector.LabelConsistencyOff)).Enum(collector.LabelConsistencies...)
 	cacheSize       = kingpin.Flag("graphite.cache-size", "Maximum size of your metric mapping cache. Relies on least recently used replacement policy if max size is reached.").Default("1000").Int()
 	cacheType       = kingpin.Flag("graphite.cache-type", "Metric mapping cache type. Valid options are \"lru\" and \"random\"").Default("lru").Enum("lru", "random")
 	dumpFSMPath     = kingpin.Flag("debug.dump-fsm", "The path to dump internal FSM generated for glob matching as Dot file.").Default("").String()
 	checkConfig     = kingpin.Flag("check-config", "Check configuration and exit.").Default("false").Bool()
+	influxAddress   = kingpin.Flag("influx.listen-address", "TCP and UDP address on which to accept InfluxDB line protocol. Disabled if empty.").Default("").String()
+	influxTemplate  = kingpin.Flag("influx.template", "Template for the Graphite path of Influx samples. {measurement} and {field} are replaced with their names.").Default(collector.DefaultInfluxTemplate).String()
+	influxHTTPWrite = kingpin.Flag("influx.http-write", "Accept InfluxDB line protocol on the /write endpoint of the web server.").Bool()
+	openTSDBAddress = kingpin.Flag("opentsdb.listen-address", "TCP and UDP address on which to accept OpenTSDB put lines. Disabled if empty.").Default("").String()
+	openTSDBHTTPPut = kingpin.Flag("opentsdb.http-put", "Accept OpenTSDB data points on the /api/put endpoint of the web server.").Bool()
 	toolkitFlags    = kingpinflag.AddFlags(kingpin.CommandLine, ":9108")
+
+	remoteWriteURL          = kingpin.Flag("remote-write.url", "Prometheus remote write endpoint to send received samples to. Disabled if empty.").Default("").String()
+	remoteWriteWALDirectory = kingpin.Flag("remote-write.wal-directory", "Directory to keep unsent remote write batches in, so that they survive restarts. Kept in memory if empty.").Default("").String()
+	remoteWriteWALMaxSize   = kingpin.Flag("remote-write.wal-max-size", "Maximum size of the unsent batches kept in the WAL directory. The oldest batches are dropped when it is exceeded. Unlimited if 0.").Default("1GB").Bytes()
+	remoteWriteCapacity     = kingpin.Flag("remote-write.queue-capacity", "Number of samples to buffer before they are batched. Samples are dropped when the buffer is full.").Default("10000").Int()
+	remoteWriteMaxSamples   = kingpin.Flag("remote-write.max-samples-per-send", "Maximum number of samples per remote write request.").Default("2000").Int()
+	remoteWriteDeadline     = kingpin.Flag("remote-write.batch-send-deadline", "Maximum time a sample waits to be sent.").Default("5s").Duration()
+	remoteWriteMaxPending   = kingpin.Flag("remote-write.max-pending-batches", "Maximum number of unsent batches to keep in memory when no WAL directory is configured.").Default("100").Int()
+	remoteWriteTimeout      = kingpin.Flag("remote-write.timeout", "Timeout for remote write requests.").Default("30s").Duration()
+
+	relayDestinations  = kingpin.Flag("relay.destination", "Carbon endpoint to forward received samples to, as host:port[:instance]. May be repeated.").Strings()
+	relayProtocol      = kingpin.Flag("relay.protocol", "Protocol for forwarding samples. Valid options are \"plaintext\" and \"pickle\".").Default(relay.ProtocolPlaintext).Enum(relay.ProtocolPlaintext, relay.ProtocolPickle)
+	relayRouting       = kingpin.Flag("relay.routing", "How samples are distributed across destinations. Valid options are \"consistent-hash\", compatible with carbon-relay, and \"fanout\".").Default(relay.RoutingConsistentHash).Enum(relay.RoutingConsistentHash, relay.RoutingFanout)
+	relayFilter        = kingpin.Flag("relay.filter", "Which samples to forward. Valid options are \"all\", \"mapped\" and \"unmapped\".").Default(relay.FilterAll).Enum(relay.FilterAll, relay.FilterMapped, relay.FilterUnmapped)
+	relayRewriteNames  = kingpin.Flag("relay.rewrite-names", "Forward samples under their mapped name, with labels as Graphite tags.").Bool()
+	relayQueueCapacity = kingpin.Flag("relay.queue-capacity", "Number of samples to buffer per destination. Samples are dropped when the buffer is full.").Default("10000").Int()
+	relayMaxBatchSize  = kingpin.Flag("relay.max-batch-size", "Maximum number of samples per write to a destination.").Default("500").Int()
+	relayTimeout       = kingpin.Flag("relay.timeout", "Timeout for connecting and writing to a destination.").Default("10s").Duration()
+
+	otlpEndpoint       = kingpin.Flag("otlp.endpoint", "OTLP endpoint to push received samples to: the URL of the metrics endpoint for http/protobuf, or host:port for grpc. Disabled if empty.").Default("").String()
+	otlpProtocol       = kingpin.Flag("otlp.protocol", "OTLP protocol. Valid options are \"http/protobuf\" and \"grpc\".").Default(otlp.ProtocolHTTP).Enum(otlp.ProtocolHTTP, otlp.ProtocolGRPC)
+	otlpInsecure       = kingpin.Flag("otlp.insecure", "Disable TLS for the grpc protocol.").Bool()
+	otlpResourceLabels = kingpin.Flag("otlp.resource-label", "Label to export as a resource attribute instead of a data point attribute. May be repeated.").Strings()
+	otlpQueueCapacity  = kingpin.Flag("otlp.queue-capacity", "Number of samples to buffer before they are exported. Samples are dropped when the buffer is full.").Default("10000").Int()
+	otlpMaxSamples     = kingpin.Flag("otlp.max-samples-per-send", "Maximum number of samples per OTLP request.").Default("2000").Int()
+	otlpDeadline       = kingpin.Flag("otlp.batch-send-deadline", "Maximum time a sample waits to be exported.").Default("5s").Duration()
+	otlpTimeout        = kingpin.Flag("otlp.timeout", "Timeout for OTLP requests.").Default("10s").Duration()
 )
 
+// stopper is an output that needs to flush queued samples on shutdown.
+type stopper interface {
+	Stop()
+}
+
+const mappingTestPath = "/api/v1/mapping/test"
+
 func init() {
 	prometheus.MustRegister(clientVersion.NewCollector("graphite_exporter"))
 }
@@ -84,14 +133,28 @@ func main() {
 	logger.Info("Starting graphite_exporter", "version_info", version.Info())
 	logger.Info(version.BuildContext())
 
-	http.Handle(*metricsPath, promhttp.Handler())
 	c := collector.NewGraphiteCollector(logger, *strictMatch, *sampleExpiry)
 	prometheus.MustRegister(c)
+	http.Handle(*metricsPath, promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(c.Gatherer(prometheus.DefaultGatherer), promhttp.HandlerOpts{EnableOpenMetrics: *openMetrics}),
+	))
+	http.Handle(mappingTestPath, c.MappingTestHandler())
+	http.Handle("/debug/unmapped", c.UnmappedHandler())
+	http.Handle("/api/v1/series", c.SeriesHandler())
+	c.SetNamingScheme(collector.NamingScheme(*namingScheme))
+	c.SetLabelConsistency(collector.LabelConsistency(*consistency))
+	c.SetInfluxTemplate(*influxTemplate)
+	if *influxHTTPWrite {
+		http.Handle("/write", c.InfluxWriteHandler())
+	}
+	if *openTSDBHTTPPut {
+		http.Handle("/api/put", c.OpenTSDBPutHandler())
+	}
 
 	metricMapper := &mapper.MetricMapper{Logger: logger}
 	if *mappingConfig != "" {
-		err := metricMapper.InitFromFile(*mappingConfig)
-		if err != nil {
+		if err := c.LoadMappingConfig(metricMapper, *mappingConfig); err != nil {
 			logger.Error("Error loading metric mapping config", "err", err)
 			os.Exit(1)
 		}
@@ -119,47 +182,103 @@ func main() {
 
 	c.SetMapper(metricMapper)
 
-	tcpSock, err := net.Listen("tcp", *graphiteAddress)
-	if err != nil {
-		logger.Error("Error binding to TCP socket", "err", err)
-		os.Exit(1)
+	var outputs []stopper
+	if *remoteWriteURL != "" {
+		sender, err := remotewrite.NewSender(remotewrite.Config{
+			URL:               *remoteWriteURL,
+			WALDirectory:      *remoteWriteWALDirectory,
+			WALMaxBytes:       int64(*remoteWriteWALMaxSize),
+			QueueCapacity:     *remoteWriteCapacity,
+			MaxSamplesPerSend: *remoteWriteMaxSamples,
+			BatchSendDeadline: *remoteWriteDeadline,
+			MaxPendingBatches: *remoteWriteMaxPending,
+			Timeout:           *remoteWriteTimeout,
+			MinBackoff:        30 * time.Millisecond,
+			MaxBackoff:        5 * time.Second,
+		}, logger)
+		if err != nil {
+			logger.Error("Error starting remote write", "err", err)
+			os.Exit(1)
+		}
+		prometheus.MustRegister(sender)
+		c.AddSampleSink(sender)
+		outputs = append(outputs, sender)
 	}
-	go func() {
-		for {
-			conn, err := tcpSock.Accept()
-			if err != nil {
-				logger.Error("Error accepting TCP connection", "err", err)
-				continue
-			}
-			go func() {
-				defer conn.Close()
-				c.ProcessReader(conn)
-			}()
+
+	if len(*relayDestinations) > 0 {
+		r, err := relay.New(relay.Config{
+			Destinations:  *relayDestinations,
+			Protocol:      *relayProtocol,
+			Routing:       *relayRouting,
+			Filter:        *relayFilter,
+			Rewrite:       *relayRewriteNames,
+			QueueCapacity: *relayQueueCapacity,
+			MaxBatchSize:  *relayMaxBatchSize,
+			Timeout:       *relayTimeout,
+			MinBackoff:    100 * time.Millisecond,
+			MaxBackoff:    10 * time.Second,
+		}, logger)
+		if err != nil {
+			logger.Error("Error starting relay", "err", err)
+			os.Exit(1)
 		}
-	}()
+		prometheus.MustRegister(r)
+		c.AddSampleSink(r)
+		outputs = append(outputs, r)
+	}
 
-	udpAddress, err := net.ResolveUDPAddr("udp", *graphiteAddress)
-	if err != nil {
-		logger.Error("Error resolving UDP address", "err", err)
-		os.Exit(1)
+	if *otlpEndpoint != "" {
+		exporter, err := otlp.NewExporter(otlp.Config{
+			Endpoint:          *otlpEndpoint,
+			Protocol:          *otlpProtocol,
+			Insecure:          *otlpInsecure,
+			ResourceLabels:    *otlpResourceLabels,
+			QueueCapacity:     *otlpQueueCapacity,
+			MaxSamplesPerSend: *otlpMaxSamples,
+			BatchSendDeadline: *otlpDeadline,
+			SeriesExpiry:      *sampleExpiry,
+			Timeout:           *otlpTimeout,
+			MinBackoff:        30 * time.Millisecond,
+			MaxBackoff:        5 * time.Second,
+		}, logger)
+		if err != nil {
+			logger.Error("Error starting OTLP exporter", "err", err)
+			os.Exit(1)
+		}
+		prometheus.MustRegister(exporter)
+		c.AddSampleSink(exporter)
+		outputs = append(outputs, exporter)
 	}
-	udpSock, err := net.ListenUDP("udp", udpAddress)
-	if err != nil {
-		logger.Error("Error listening to UDP address", "err", err)
+
+	if len(outputs) > 0 {
+		go func() {
+			term := make(chan os.Signal, 1)
+			signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+			<-term
+			logger.Info("Flushing queued samples")
+			for _, o := range outputs {
+				o.Stop()
+			}
+			os.Exit(0)
+		}()
+	}
+
+	if err := listen(*graphiteAddress, c.ProcessReader, logger); err != nil {
+		logger.Error("Error listening for Graphite samples", "err", err)
 		os.Exit(1)
 	}
-	go func() {
-		defer udpSock.Close()
-		for {
-			buf := make([]byte, 65536)
-			chars, srcAddress, err := udpSock.ReadFromUDP(buf)
-			if err != nil {
-				logger.Error("Error reading UDP packet", "from", srcAddress, "err", err)
-				continue
-			}
-			go c.ProcessReader(bytes.NewReader(buf[0:chars]))
+	if *influxAddress != "" {
+		if err := listen(*influxAddress, c.ProcessInfluxReader, logger); err != nil {
+			logger.Error("Error listening for Influx samples", "err", err)
+			os.Exit(1)
 		}
-	}()
+	}
+	if *openTSDBAddress != "" {
+		if err := listen(*openTSDBAddress, c.ProcessOpenTSDBReader, logger); err != nil {
+			logger.Error("Error listening for OpenTSDB samples", "err", err)
+			os.Exit(1)
+		}
+	}
 
 	if *metricsPath != "/" {
 		landingConfig := web.LandingConfig{
@@ -167,11 +286,30 @@ func main() {
 			Description: "Prometheus Graphite Exporter",
 			ExtraHTML:   `<p>Accepting plaintext Graphite samples over TCP and UDP on ` + *graphiteAddress + `</p>`,
 			Version:     version.Info(),
+			Form: web.LandingForm{
+				Action: mappingTestPath,
+				Inputs: []web.LandingFormInput{
+					{
+						Label:       "Test mapping for Graphite metric",
+						Type:        "text",
+						Name:        "name",
+						Placeholder: "foo.bar.baz;tag=value",
+					},
+				},
+			},
 			Links: []web.LandingLinks{
 				{
 					Address: *metricsPath,
 					Text:    "Metrics",
 				},
+				{
+					Address: "/api/v1/series",
+					Text:    "Series",
+				},
+				{
+					Address: "/debug/unmapped",
+					Text:    "Unmapped metrics",
+				},
 			},
 		}
 		landingPage, err := web.NewLandingPage(landingConfig)
@@ -189,6 +327,50 @@ func main() {
 	}
 }
 
+// listen accepts samples over TCP and UDP on address and passes each
+// connection or packet to process.
+func listen(address string, process func(io.Reader), logger *slog.Logger) error {
+	tcpSock, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("binding to TCP socket: %w", err)
+	}
+	go func() {
+		for {
+			conn, err := tcpSock.Accept()
+			if err != nil {
+				logger.Error("Error accepting TCP connection", "err", err)
+				continue
+			}
+			go func() {
+				defer conn.Close()
+				process(conn)
+			}()
+		}
+	}()
+
+	udpAddress, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return fmt.Errorf("resolving UDP address: %w", err)
+	}
+	udpSock, err := net.ListenUDP("udp", udpAddress)
+	if err != nil {
+		return fmt.Errorf("listening to UDP address: %w", err)
+	}
+	go func() {
+		defer udpSock.Close()
+		for {
+			buf := make([]byte, 65536)
+			chars, srcAddress, err := udpSock.ReadFromUDP(buf)
+			if err != nil {
+				logger.Error("Error reading UDP packet", "from", srcAddress, "err", err)
+				continue
+			}
+			go process(bytes.NewReader(buf[0:chars]))
+		}
+	}()
+	return nil
+}
+
 // TODO(mr): this is copied verbatim from statsd_exporter/main.go. It should be a
 // convenience function in mappercache, but that caused an import cycle.
 func getCache(cacheSize int, cacheType string, registerer prometheus.Registerer) (mapper.MetricMapperCache, error) {
@@ -0,0 +1,115 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+// MappingResult describes how a Graphite metric path is translated into a
+// Prometheus metric, without storing a sample.
+type MappingResult struct {
+	Input      string            `json:"input"`
+	ParsedName string            `json:"parsed_name"`
+	TagError   string            `json:"tag_error,omitempty"`
+	Matched    bool              `json:"matched"`
+	Rule       string            `json:"rule,omitempty"`
+	MatchType  string            `json:"match_type,omitempty"`
+	Action     string            `json:"action"`
+	Name       string            `json:"name"`
+	Labels     prometheus.Labels `json:"labels"`
+	// Dropped is true if the sample would be discarded with the current
+	// configuration.
+	Dropped bool `json:"dropped"`
+	// StrictMatchDrop is true if no mapping matched, so the sample would be
+	// discarded when strict matching is enabled.
+	StrictMatchDrop bool `json:"strict_match_drop"`
+}
+
+// TestMapping runs a Graphite metric path, including any tags, through the
+// same parsing and mapping as incoming samples.
+func (c *graphiteCollector) TestMapping(name string) MappingResult {
+	m := c.mapMetric(name)
+
+	r := MappingResult{
+		Input:           name,
+		ParsedName:      m.parsedName,
+		Matched:         m.present,
+		Action:          string(mapper.ActionTypeMap),
+		Name:            m.name,
+		Labels:          m.labels,
+		Dropped:         m.dropped(c.strictMatch),
+		StrictMatchDrop: !m.present,
+	}
+	if m.tagErr != nil {
+		r.TagError = m.tagErr.Error()
+	}
+	if m.present {
+		r.Rule = m.mapping.Match
+		r.MatchType = string(m.mapping.MatchType)
+	}
+	if r.Dropped {
+		r.Action = string(mapper.ActionTypeDrop)
+	}
+	return r
+}
+
+// MappingTestHandler returns an HTTP handler that reports the result of
+// TestMapping for the metric path given in the "name" query parameter.
+func (c *graphiteCollector) MappingTestHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.FormValue("name")
+		if name == "" {
+			http.Error(w, "missing name parameter", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, c.TestMapping(name))
+	})
+}
+
+// UnmappedHandler returns an HTTP handler that lists the most frequent metric
+// names, without tags, that did not match any mapping. The optional "limit"
+// query parameter caps the number of names returned.
+func (c *graphiteCollector) UnmappedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := 0
+		if l := r.FormValue("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+				http.Error(w, fmt.Sprintf("invalid limit %q", l), http.StatusBadRequest)
+				return
+			}
+		}
+		metrics, total := c.unmapped.top(limit)
+		writeJSON(w, struct {
+			Total   uint64           `json:"total"`
+			Metrics []UnmappedMetric `json:"metrics"`
+		}{total, metrics})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
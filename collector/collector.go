@@ -15,46 +15,66 @@ package collector
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"math"
 	_ "net/http/pprof"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/statsd_exporter/pkg/mapper"
 )
 
 var invalidMetricChars = regexp.MustCompile("[^a-zA-Z0-9_:]")
 
 type graphiteCollector struct {
-	samples            map[string]*graphiteSample
-	mu                 *sync.Mutex
-	mapper             metricMapper
-	sampleCh           chan *graphiteSample
-	lineCh             chan string
-	strictMatch        bool
-	logger             *slog.Logger
-	droppedSamples     prometheus.Counter
-	tagParseFailures   prometheus.Counter
-	lastProcessed      prometheus.Gauge
-	sampleExpiryMetric prometheus.Gauge
-	sampleExpiry       time.Duration
+	samples               map[string]*Sample
+	seriesOwners          map[string]string
+	schemas               map[string]*labelSchema
+	mu                    *sync.Mutex
+	mapper                metricMapper
+	sampleCh              chan *Sample
+	lineCh                chan string
+	pointCh               chan point
+	strictMatch           bool
+	logger                *slog.Logger
+	droppedSamples        prometheus.Counter
+	tagParseFailures      prometheus.Counter
+	tagErrors             *prometheus.CounterVec
+	seriesCollisions      prometheus.Counter
+	labelConsistency      LabelConsistency
+	labelConsistencyFixes *prometheus.CounterVec
+	mappingMatches        *prometheus.CounterVec
+	rules                 map[mappingKey]mappingRule
+	unmapped              *unmappedTracker
+	sinks                 []SampleSink
+	influxTemplate        string
+	namingScheme          NamingScheme
+	mappingOptions        mappingsOptions
+	lastProcessed         prometheus.Gauge
+	sampleExpiryMetric    prometheus.Gauge
+	sampleExpiry          time.Duration
 }
 
 func NewGraphiteCollector(logger *slog.Logger, strictMatch bool, sampleExpiry time.Duration) *graphiteCollector {
 	c := &graphiteCollector{
-		sampleCh:    make(chan *graphiteSample),
-		lineCh:      make(chan string),
-		mu:          &sync.Mutex{},
-		samples:     map[string]*graphiteSample{},
-		strictMatch: strictMatch,
-		logger:      logger,
+		sampleCh:     make(chan *Sample),
+		lineCh:       make(chan string),
+		pointCh:      make(chan point),
+		mu:           &sync.Mutex{},
+		samples:      map[string]*Sample{},
+		seriesOwners: map[string]string{},
+		schemas:      map[string]*labelSchema{},
+		strictMatch:  strictMatch,
+		logger:       logger,
 		droppedSamples: prometheus.NewCounter(
 			prometheus.CounterOpts{
 				Name: "graphite_dropped_samples_total",
@@ -65,6 +85,36 @@ func NewGraphiteCollector(logger *slog.Logger, strictMatch bool, sampleExpiry ti
 				Name: "graphite_tag_parse_failures",
 				Help: "Total count of samples with invalid tags",
 			}),
+		tagErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "graphite_tag_errors_total",
+				Help: "Total count of invalid tags by reason. Keys that are not valid label names are sanitized, duplicate keys keep the last value, and other invalid tags are dropped.",
+			},
+			[]string{"reason"},
+		),
+		seriesCollisions: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "graphite_series_collisions_total",
+				Help: "Total count of samples dropped because a different Graphite metric resulted in the same series.",
+			}),
+		labelConsistency: LabelConsistencyOff,
+		labelConsistencyFixes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "graphite_label_consistency_fixes_total",
+				Help: "Total count of samples whose labels differed from the first sample with the same metric name, by action taken.",
+			},
+			[]string{"action"},
+		),
+		mappingMatches: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "graphite_mapping_matches_total",
+				Help: "Total count of samples matched by each mapping rule, by its index in the mapping configuration and its metric name.",
+			},
+			[]string{"rule", "name"},
+		),
+		unmapped:       newUnmappedTracker(unmappedTopK),
+		influxTemplate: DefaultInfluxTemplate,
+		namingScheme:   NamingSchemeLegacy,
 		lastProcessed: prometheus.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "graphite_last_processed_timestamp_seconds",
@@ -80,6 +130,12 @@ func NewGraphiteCollector(logger *slog.Logger, strictMatch bool, sampleExpiry ti
 		),
 	}
 	c.sampleExpiryMetric.Set(sampleExpiry.Seconds())
+	for _, reason := range tagErrorReasons {
+		c.tagErrors.WithLabelValues(reason)
+	}
+	for _, action := range []string{labelsFilled, labelsRemoved, labelsDropped} {
+		c.labelConsistencyFixes.WithLabelValues(action)
+	}
 	go c.processSamples()
 	go c.processLines()
 	return c
@@ -95,105 +151,296 @@ func (c *graphiteCollector) ProcessReader(reader io.Reader) {
 	}
 }
 
+// mappingRule holds the labels of the match counter of a mapping rule: its
+// index in the mapping configuration, and its metric name.
+type mappingRule struct {
+	index, name string
+}
+
+// SetMapper sets the mapper, and the rules whose matches are counted. The
+// counters of rules that the mapper no longer has are removed.
 func (c *graphiteCollector) SetMapper(m metricMapper) {
 	c.mapper = m
+
+	rules := map[mappingKey]mappingRule{}
+	if mm, ok := m.(*mapper.MetricMapper); ok {
+		for key, i := range graphiteMappings(mm) {
+			rules[key] = mappingRule{index: strconv.Itoa(i), name: mm.Mappings[i].Name}
+		}
+	}
+	for key, rule := range c.rules {
+		if rules[key] != rule {
+			c.mappingMatches.DeleteLabelValues(rule.index, rule.name)
+		}
+	}
+	// Initialize the match counters so that rules without any matches show up.
+	for _, rule := range rules {
+		c.mappingMatches.WithLabelValues(rule.index, rule.name)
+	}
+	c.rules = rules
+}
+
+// SetNamingScheme sets how Graphite paths and tag keys are turned into metric
+// and label names.
+func (c *graphiteCollector) SetNamingScheme(s NamingScheme) {
+	c.namingScheme = s
+}
+
+// AddSampleSink registers a sink that receives every valid sample the
+// collector receives, as it is exposed. Samples that are not exposed, because
+// the mapping configuration drops them, they collide with another metric or
+// their labels are inconsistent, are passed with Dropped set. It must be
+// called before samples are processed.
+func (c *graphiteCollector) AddSampleSink(s SampleSink) {
+	c.sinks = append(c.sinks, s)
 }
 
 func (c *graphiteCollector) processLines() {
-	for line := range c.lineCh {
-		c.processLine(line)
+	for {
+		select {
+		case line := <-c.lineCh:
+			c.processLine(line)
+		case p := <-c.pointCh:
+			c.processPoint(p)
+		}
 	}
 }
 
-func (c *graphiteCollector) parseMetricNameAndTags(name string) (string, prometheus.Labels, error) {
-	var err error
+// metricMapping is the result of running a Graphite metric path through tag
+// parsing and the metric mapper.
+type metricMapping struct {
+	parsedName string
+	name       string
+	labels     prometheus.Labels
+	mapping    *mapper.MetricMapping
+	present    bool
+	help       string
+	unit       string
+	cumulative bool
+	tagErr     error
+}
 
-	labels := make(prometheus.Labels)
+// dropped reports whether samples for this metric are discarded, either by a
+// drop action or because strict matching is enabled and no mapping matched.
+func (m metricMapping) dropped(strictMatch bool) bool {
+	return (m.present && m.mapping.Action == mapper.ActionTypeDrop) || (!m.present && strictMatch)
+}
 
-	parts := strings.Split(name, ";")
-	parsedName := parts[0]
+func (c *graphiteCollector) mapMetric(originalName string) metricMapping {
+	parsedName, labels, err := c.parseMetricNameAndTags(originalName)
 
-	tags := parts[1:]
-	for _, tag := range tags {
-		kv := strings.SplitN(tag, "=", 2)
-		if len(kv) != 2 {
-			// don't add this tag, continue processing tags but return an error
-			c.tagParseFailures.Inc()
-			err = fmt.Errorf("error parsing tag %s", tag)
-			continue
-		}
+	mapping, mappingLabels, mappingPresent := c.mapper.GetMapping(parsedName, mapper.MetricTypeGauge)
 
-		k := kv[0]
-		v := kv[1]
+	// add mapping labels to parsed labels
+	for k, v := range mappingLabels {
 		labels[k] = v
 	}
 
-	return parsedName, labels, err
+	var (
+		name, help string
+		options    mappingOptions
+	)
+	if mappingPresent {
+		name = c.namingScheme.MappedName(mapping.Name)
+		help = mapping.HelpText
+		options = c.mappingOptions.get(mapping)
+	} else {
+		name = c.namingScheme.MetricName(parsedName)
+	}
+	if help == "" {
+		help = fmt.Sprintf("Graphite metric %s", name)
+	}
+
+	return metricMapping{
+		parsedName: parsedName,
+		name:       name,
+		labels:     labels,
+		mapping:    mapping,
+		present:    mappingPresent,
+		help:       help,
+		unit:       options.unit,
+		cumulative: options.cumulative,
+		tagErr:     err,
+	}
+}
+
+// point is a sample received in another protocol, converted to a Graphite
+// path with tags.
+type point struct {
+	originalName string
+	value        float64
+	timestamp    time.Time
+}
+
+var (
+	pathSanitizer   = strings.NewReplacer(" ", "_", ";", "_")
+	tagKeySanitizer = strings.NewReplacer(" ", "_", ";", "_", "=", "_", "!", "_", "^", "_")
+)
+
+// taggedPath formats a path and tags from another protocol as a Graphite path
+// with tags, replacing characters that would change how it is parsed.
+func taggedPath(path string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(pathSanitizer.Replace(path))
+	for _, k := range keys {
+		b.WriteString(";")
+		b.WriteString(tagKeySanitizer.Replace(k))
+		b.WriteString("=")
+		b.WriteString(pathSanitizer.Replace(tags[k]))
+	}
+	return b.String()
 }
 
 func (c *graphiteCollector) processLine(line string) {
+	sample, err := c.parseLine(line)
+	if err != nil || sample == nil {
+		return
+	}
+	c.storeSample(sample)
+}
+
+func (c *graphiteCollector) processPoint(p point) {
+	m := c.mapMetric(p.originalName)
+	dropped := c.observeMapping(m, p.originalName)
+	sample := c.newSample(p.originalName, m, p.value, p.timestamp)
+	sample.Dropped = dropped
+	c.storeSample(sample)
+}
+
+func (c *graphiteCollector) storeSample(sample *Sample) {
+	c.logger.Debug("Processing sample", "sample", sample)
+	c.lastProcessed.Set(float64(time.Now().UnixNano()) / 1e9)
+	if sample.Dropped {
+		c.appendToSinks(sample)
+		return
+	}
+	c.sampleCh <- sample
+}
+
+func (c *graphiteCollector) appendToSinks(sample *Sample) {
+	for _, s := range c.sinks {
+		s.Append(sample)
+	}
+}
+
+// ParseLine turns a line of the Graphite plaintext protocol into a sample
+// without storing it. It returns an error if the line is invalid, and a nil
+// sample if the sample is dropped by the mapping configuration.
+func (c *graphiteCollector) ParseLine(line string) (*Sample, error) {
+	sample, err := c.parseLine(line)
+	if err != nil || sample == nil || sample.Dropped {
+		return nil, err
+	}
+	return sample, nil
+}
+
+// parseLine is like ParseLine, but returns dropped samples with Dropped set,
+// so that they can be passed to sinks. Invalid lines are only an error if
+// the sample would not have been dropped anyway.
+func (c *graphiteCollector) parseLine(line string) (*Sample, error) {
 	line = strings.TrimSpace(line)
 	c.logger.Debug("Incoming line", "line", line)
 
 	parts := strings.Split(line, " ")
 	if len(parts) != 3 {
 		c.logger.Info("Invalid part count", "parts", len(parts), "line", line)
-		return
+		return nil, fmt.Errorf("invalid part count %d", len(parts))
 	}
 
 	originalName := parts[0]
 
-	parsedName, labels, err := c.parseMetricNameAndTags(originalName)
+	m := c.mapMetric(originalName)
+	dropped := c.observeMapping(m, line)
+
+	value, err := strconv.ParseFloat(parts[1], 64)
 	if err != nil {
-		c.logger.Debug("Invalid tags", "line", line, "err", err.Error())
+		if dropped {
+			return nil, nil
+		}
+		c.logger.Info("Invalid value", "line", line)
+		return nil, fmt.Errorf("invalid value: %w", err)
 	}
 
-	mapping, mappingLabels, mappingPresent := c.mapper.GetMapping(parsedName, mapper.MetricTypeGauge)
-
-	// add mapping labels to parsed labels
-	for k, v := range mappingLabels {
-		labels[k] = v
+	timestamp, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		if dropped {
+			return nil, nil
+		}
+		c.logger.Info("Invalid timestamp", "line", line)
+		return nil, fmt.Errorf("invalid timestamp: %w", err)
 	}
+	sample := c.newSample(originalName, m, value, time.Unix(int64(timestamp), int64(math.Mod(timestamp, 1.0)*1e9)))
+	sample.Dropped = dropped
+	return sample, nil
+}
 
-	if (mappingPresent && mapping.Action == mapper.ActionTypeDrop) || (!mappingPresent && c.strictMatch) {
-		c.logger.Debug("Dropped line", "line", line)
-		c.droppedSamples.Inc()
-		return
+// observeMapping updates the tag, mapping and drop counters for a metric and
+// reports whether its samples are dropped. The input is only used for logging.
+func (c *graphiteCollector) observeMapping(m metricMapping, input string) bool {
+	if m.tagErr != nil {
+		c.logger.Debug("Invalid tags", "line", input, "err", m.tagErr.Error())
+		var errs tagErrors
+		if errors.As(m.tagErr, &errs) {
+			// Sanitized and duplicate keys are kept, so they are only
+			// counted by reason.
+			rejected := false
+			for _, e := range errs {
+				c.tagErrors.WithLabelValues(e.reason).Inc()
+				if e.reason != tagReasonSanitizedKey && e.reason != tagReasonDuplicateKey {
+					rejected = true
+				}
+			}
+			if rejected {
+				c.tagParseFailures.Inc()
+			}
+		} else {
+			c.tagParseFailures.Inc()
+		}
 	}
 
-	var name string
-	if mappingPresent {
-		name = invalidMetricChars.ReplaceAllString(mapping.Name, "_")
+	if m.present {
+		if rule, ok := c.rules[keyOf(m.mapping)]; ok {
+			c.mappingMatches.WithLabelValues(rule.index, rule.name).Inc()
+		}
 	} else {
-		name = invalidMetricChars.ReplaceAllString(parsedName, "_")
+		c.unmapped.observe(m.parsedName)
 	}
 
-	value, err := strconv.ParseFloat(parts[1], 64)
-	if err != nil {
-		c.logger.Info("Invalid value", "line", line)
-		return
-	}
-	if mappingPresent && mapping.Scale.Set {
-		value *= mapping.Scale.Val
+	if m.dropped(c.strictMatch) {
+		c.logger.Debug("Dropped line", "line", input)
+		c.droppedSamples.Inc()
+		return true
 	}
+	return false
+}
 
-	timestamp, err := strconv.ParseFloat(parts[2], 64)
-	if err != nil {
-		c.logger.Info("Invalid timestamp", "line", line)
-		return
+func (c *graphiteCollector) newSample(originalName string, m metricMapping, value float64, timestamp time.Time) *Sample {
+	originalValue := value
+	if m.present && m.mapping.Scale.Set {
+		value *= m.mapping.Scale.Val
 	}
-	sample := graphiteSample{
-		OriginalName: originalName,
-		Name:         name,
-		Value:        value,
-		Labels:       labels,
-		Type:         prometheus.GaugeValue,
-		Help:         fmt.Sprintf("Graphite metric %s", name),
-		Timestamp:    time.Unix(int64(timestamp), int64(math.Mod(timestamp, 1.0)*1e9)),
+	valueType := prometheus.GaugeValue
+	if m.cumulative {
+		valueType = prometheus.CounterValue
+	}
+	return &Sample{
+		OriginalName:  originalName,
+		Name:          m.name,
+		Value:         value,
+		OriginalValue: originalValue,
+		Labels:        m.labels,
+		Type:          valueType,
+		Help:          m.help,
+		Unit:          m.unit,
+		Timestamp:     timestamp,
+		Mapped:        m.present,
 	}
-	c.logger.Debug("Processing sample", "sample", sample)
-	c.lastProcessed.Set(float64(time.Now().UnixNano()) / 1e9)
-	c.sampleCh <- &sample
 }
 
 func (c *graphiteCollector) processSamples() {
@@ -206,15 +453,16 @@ func (c *graphiteCollector) processSamples() {
 				return
 			}
 			c.mu.Lock()
-			c.samples[sample.OriginalName] = sample
+			sample = c.storeLocked(sample)
 			c.mu.Unlock()
+			c.appendToSinks(sample)
 		case <-ticker:
 			// Garbage collect expired samples.
 			ageLimit := time.Now().Add(-c.sampleExpiry)
 			c.mu.Lock()
 			for k, sample := range c.samples {
 				if ageLimit.After(sample.Timestamp) {
-					delete(c.samples, k)
+					c.deleteLocked(k)
 				}
 			}
 			c.mu.Unlock()
@@ -222,18 +470,103 @@ func (c *graphiteCollector) processSamples() {
 	}
 }
 
+// storeLocked stores a sample unless it collides with a sample from a
+// different Graphite metric that results in the same series. Of the metrics
+// that have not expired, the one with the lowest original name wins, so the
+// outcome does not depend on the order in which samples arrive. It returns the
+// sample as stored, or with Dropped set if it was not stored.
+func (c *graphiteCollector) storeLocked(sample *Sample) *Sample {
+	conformed := c.conformLocked(sample)
+	if conformed == nil {
+		sample.Dropped = true
+		return sample
+	}
+	sample = conformed
+	key := c.seriesKey(sample)
+	if owner, ok := c.seriesOwners[key]; ok && owner != sample.OriginalName {
+		existing := c.samples[owner]
+		live := !time.Now().Add(-c.sampleExpiry).After(existing.Timestamp)
+		if live && owner < sample.OriginalName {
+			c.seriesCollisions.Inc()
+			c.logger.Info("Dropped sample colliding with another metric", "metric", sample.OriginalName, "kept", owner, "series", sample.Name)
+			sample.Dropped = true
+			return sample
+		}
+		if live {
+			c.seriesCollisions.Inc()
+			c.logger.Info("Replaced sample colliding with another metric", "metric", owner, "kept", sample.OriginalName, "series", sample.Name)
+		}
+		c.deleteLocked(owner)
+	}
+	if old, ok := c.samples[sample.OriginalName]; ok {
+		// The series of a metric changes when the mapping is reloaded.
+		if oldKey := c.seriesKey(old); oldKey != key && c.seriesOwners[oldKey] == sample.OriginalName {
+			delete(c.seriesOwners, oldKey)
+		}
+		c.unrefSchemaLocked(old)
+	}
+	c.refSchemaLocked(sample)
+	c.samples[sample.OriginalName] = sample
+	c.seriesOwners[key] = sample.OriginalName
+	return sample
+}
+
+func (c *graphiteCollector) deleteLocked(originalName string) {
+	sample, ok := c.samples[originalName]
+	if !ok {
+		return
+	}
+	delete(c.samples, originalName)
+	c.unrefSchemaLocked(sample)
+	if key := c.seriesKey(sample); c.seriesOwners[key] == originalName {
+		delete(c.seriesOwners, key)
+	}
+}
+
+// seriesKey identifies the series a sample is exposed as. With the utf8
+// naming scheme, names are escaped the way they are for scrapers that do not
+// support UTF-8, so that metrics that only differ in characters that are
+// escaped also collide.
+func (c *graphiteCollector) seriesKey(s *Sample) string {
+	names := make([]string, 0, len(s.Labels))
+	for k := range s.Labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	escape := func(name string) string { return name }
+	if c.namingScheme == NamingSchemeUTF8 {
+		escape = func(name string) string { return model.EscapeName(name, model.UnderscoreEscaping) }
+	}
+
+	var b strings.Builder
+	b.WriteString(escape(s.Name))
+	for _, k := range names {
+		b.WriteByte(model.SeparatorByte)
+		b.WriteString(escape(k))
+		b.WriteByte(model.SeparatorByte)
+		b.WriteString(s.Labels[k])
+	}
+	return b.String()
+}
+
 // Collect implements prometheus.Collector.
 func (c graphiteCollector) Collect(ch chan<- prometheus.Metric) {
 	c.droppedSamples.Collect(ch)
 	c.lastProcessed.Collect(ch)
 	c.sampleExpiryMetric.Collect(ch)
 	c.tagParseFailures.Collect(ch)
+	c.tagErrors.Collect(ch)
+	c.seriesCollisions.Collect(ch)
+	c.labelConsistencyFixes.Collect(ch)
+	c.mappingMatches.Collect(ch)
 
 	c.mu.Lock()
-	samples := make([]*graphiteSample, 0, len(c.samples))
+	samples := make([]*Sample, 0, len(c.samples))
 	for _, sample := range c.samples {
 		samples = append(samples, sample)
 	}
+	md := c.metadataLocked()
 	c.mu.Unlock()
 
 	ageLimit := time.Now().Add(-c.sampleExpiry)
@@ -242,8 +575,8 @@ func (c graphiteCollector) Collect(ch chan<- prometheus.Metric) {
 			continue
 		}
 		ch <- prometheus.MustNewConstMetric(
-			prometheus.NewDesc(sample.Name, sample.Help, []string{}, sample.Labels),
-			sample.Type,
+			prometheus.NewDesc(sample.Name, md[sample.Name].help, []string{}, sample.Labels),
+			md[sample.Name].valueType,
 			sample.Value,
 		)
 	}
@@ -256,22 +589,47 @@ func (c graphiteCollector) Describe(ch chan<- *prometheus.Desc) {
 	c.lastProcessed.Describe(ch)
 	c.sampleExpiryMetric.Describe(ch)
 	c.tagParseFailures.Describe(ch)
+	c.tagErrors.Describe(ch)
+	c.seriesCollisions.Describe(ch)
+	c.labelConsistencyFixes.Describe(ch)
+	c.mappingMatches.Describe(ch)
 }
 
-type graphiteSample struct {
+// Sample is a Graphite sample translated into a Prometheus sample.
+type Sample struct {
 	OriginalName string
 	Name         string
 	Labels       prometheus.Labels
 	Help         string
-	Value        float64
-	Type         prometheus.ValueType
-	Timestamp    time.Time
+	// Unit is the unit of the metric, such as "seconds", if the mapping
+	// specifies one.
+	Unit  string
+	Value float64
+	// OriginalValue is the value as it was received, before any scale of the
+	// mapping was applied.
+	OriginalValue float64
+	// Type is prometheus.CounterValue if the mapping marks the metric as
+	// cumulative, and prometheus.GaugeValue otherwise.
+	Type      prometheus.ValueType
+	Timestamp time.Time
+	// Mapped is true if a mapping rule matched the metric.
+	Mapped bool
+	// Dropped is true if the sample is not exposed, because it is discarded by
+	// a drop action or strict matching, collides with another metric or has
+	// inconsistent labels. Such samples are only passed to sinks.
+	Dropped bool
 }
 
-func (s graphiteSample) String() string {
+func (s Sample) String() string {
 	return fmt.Sprintf("%#v", s)
 }
 
+// SampleSink receives samples as they are processed, including dropped
+// samples. Append must not block and must not modify the sample.
+type SampleSink interface {
+	Append(*Sample)
+}
+
 type metricMapper interface {
 	GetMapping(string, mapper.MetricType) (*mapper.MetricMapping, prometheus.Labels, bool)
 	InitFromFile(string) error
@@ -60,6 +60,7 @@ rspamd.spam_count 3 NOW`
 type mockMapper struct {
 	labels  prometheus.Labels
 	present bool
+	match   string
 	name    string
 	action  mapper.ActionType
 	scale   mapper.MaybeFloat64
@@ -67,6 +68,7 @@ type mockMapper struct {
 
 func (m *mockMapper) GetMapping(metricName string, metricType mapper.MetricType) (*mapper.MetricMapping, prometheus.Labels, bool) {
 	mapping := mapper.MetricMapping{
+		Match:  m.match,
 		Name:   m.name,
 		Action: m.action,
 		Scale:  m.scale,
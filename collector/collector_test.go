@@ -14,11 +14,20 @@
 package collector
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/promslog"
 	"github.com/prometheus/statsd_exporter/pkg/mapper"
 	"github.com/stretchr/testify/assert"
@@ -60,12 +69,47 @@ func TestParseNameAndTags(t *testing.T) {
 			},
 			willError: true,
 		},
+		"tag value containing equals sign": {
+			line:       "my_metric;query=a=b;tag2=value2",
+			parsedName: "my_metric",
+			labels: prometheus.Labels{
+				"query": "a=b",
+				"tag2":  "value2",
+			},
+		},
+		"invalid tags are dropped": {
+			line:       "my_metric;=value;tag1=;tag!2=value;tag3=~value;name=other;__name__=other;tag4=value4",
+			parsedName: "my_metric",
+			labels: prometheus.Labels{
+				"tag4": "value4",
+			},
+			willError: true,
+		},
+		"tag keys are sanitized": {
+			line:       "my_metric;host-name=web-01;1tag=value",
+			parsedName: "my_metric",
+			labels: prometheus.Labels{
+				"host_name": "web-01",
+				"_1tag":     "value",
+			},
+			willError: true,
+		},
+		"duplicate tag keeps last value": {
+			line:       "my_metric;tag1=value1;tag1=value2",
+			parsedName: "my_metric",
+			labels: prometheus.Labels{
+				"tag1": "value2",
+			},
+			willError: true,
+		},
 	}
 
 	for name, testCase := range testCases {
 		t.Run(name, func(t *testing.T) {
 			n, parsedLabels, err := c.parseMetricNameAndTags(testCase.line)
-			if !testCase.willError {
+			if testCase.willError {
+				assert.Error(t, err, "Expected error parsing %s", testCase.line)
+			} else {
 				assert.NoError(t, err, "Got unexpected error parsing %s", testCase.line)
 			}
 			assert.Equal(t, testCase.parsedName, n)
@@ -74,6 +118,34 @@ func TestParseNameAndTags(t *testing.T) {
 	}
 }
 
+func TestTagErrors(t *testing.T) {
+	c := NewGraphiteCollector(promslog.NewNopLogger(), false, 5*time.Minute)
+	c.mapper = &mockMapper{present: false}
+
+	for _, line := range []string{
+		"my.metric;tag1;tag2=~value 1 1534620625",
+		"my.metric;name=other;__name__=other;host-name=a;host-name=b 1 1534620625",
+		"my.metric;tag1=value1 1 1534620625",
+		"my.metric;host-name=a;tag1=value1;tag1=value2 1 1534620625",
+	} {
+		c.processLine(line)
+	}
+	c.sampleCh <- nil
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(c.tagParseFailures))
+	for reason, count := range map[string]float64{
+		tagReasonMissingSeparator: 1,
+		tagReasonEmptyKey:         0,
+		tagReasonInvalidValue:     1,
+		tagReasonReservedKey:      2,
+		tagReasonSanitizedKey:     3,
+		tagReasonDuplicateKey:     2,
+	} {
+		assert.Equal(t, count, testutil.ToFloat64(c.tagErrors.WithLabelValues(reason)), reason)
+	}
+	assert.Equal(t, prometheus.Labels{"host_name": "b"}, c.samples["my.metric;name=other;__name__=other;host-name=a;host-name=b"].Labels)
+}
+
 func TestProcessLine(t *testing.T) {
 	type testCase struct {
 		line           string
@@ -254,3 +326,797 @@ func TestProcessLine(t *testing.T) {
 		})
 	}
 }
+
+func TestMappingTestHandler(t *testing.T) {
+	c := NewGraphiteCollector(promslog.NewNopLogger(), false, 5*time.Minute)
+
+	type testCase struct {
+		mapper   *mockMapper
+		strict   bool
+		query    string
+		status   int
+		expected MappingResult
+	}
+
+	testCases := map[string]testCase{
+		"mapped metric with tags": {
+			mapper: &mockMapper{
+				name:    "foo_bar",
+				labels:  prometheus.Labels{"baz": "qux"},
+				present: true,
+			},
+			query:  "name=" + url.QueryEscape("foo.bar.qux;tag1=value1"),
+			status: http.StatusOK,
+			expected: MappingResult{
+				Input:      "foo.bar.qux;tag1=value1",
+				ParsedName: "foo.bar.qux",
+				Matched:    true,
+				Action:     "map",
+				Name:       "foo_bar",
+				Labels:     prometheus.Labels{"baz": "qux", "tag1": "value1"},
+			},
+		},
+		"unmapped metric": {
+			mapper: &mockMapper{},
+			query:  "name=foo.bar.baz",
+			status: http.StatusOK,
+			expected: MappingResult{
+				Input:           "foo.bar.baz",
+				ParsedName:      "foo.bar.baz",
+				Action:          "map",
+				Name:            "foo_bar_baz",
+				Labels:          prometheus.Labels{},
+				StrictMatchDrop: true,
+			},
+		},
+		"unmapped metric with strict match": {
+			mapper: &mockMapper{},
+			strict: true,
+			query:  "name=foo.bar.baz",
+			status: http.StatusOK,
+			expected: MappingResult{
+				Input:           "foo.bar.baz",
+				ParsedName:      "foo.bar.baz",
+				Action:          "drop",
+				Name:            "foo_bar_baz",
+				Labels:          prometheus.Labels{},
+				Dropped:         true,
+				StrictMatchDrop: true,
+			},
+		},
+		"dropped metric with invalid tag": {
+			mapper: &mockMapper{
+				name:    "foo",
+				present: true,
+				action:  mapper.ActionTypeDrop,
+			},
+			query:  "name=" + url.QueryEscape("foo.bar;tag1"),
+			status: http.StatusOK,
+			expected: MappingResult{
+				Input:      "foo.bar;tag1",
+				ParsedName: "foo.bar",
+				TagError:   `missing separator in tag "tag1"`,
+				Matched:    true,
+				Action:     "drop",
+				Name:       "foo",
+				Labels:     prometheus.Labels{},
+				Dropped:    true,
+			},
+		},
+		"missing name": {
+			mapper: &mockMapper{},
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c.mapper = testCase.mapper
+			c.strictMatch = testCase.strict
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/mapping/test?"+testCase.query, nil)
+			c.MappingTestHandler().ServeHTTP(rec, req)
+
+			assert.Equal(t, testCase.status, rec.Code)
+			if testCase.status != http.StatusOK {
+				return
+			}
+			var result MappingResult
+			if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result)) {
+				assert.Equal(t, testCase.expected, result)
+			}
+		})
+	}
+}
+
+func TestMappingMatchesReload(t *testing.T) {
+	c := NewGraphiteCollector(promslog.NewNopLogger(), false, 5*time.Minute)
+	metricMapper := &mapper.MetricMapper{Logger: promslog.NewNopLogger()}
+	// Rules with the same match are told apart by their index.
+	assert.NoError(t, metricMapper.InitFromYAMLString(`mappings:
+- match: foo.*
+  match_metric_type: counter
+  name: foo_total
+- match: foo.*
+  name: foo
+- match: bar.*
+  name: bar
+`))
+	c.SetMapper(metricMapper)
+	c.processLine("foo.a 1 1534620625")
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.mappingMatches.WithLabelValues("1", "foo")))
+	assert.Equal(t, 2, testutil.CollectAndCount(c.mappingMatches))
+
+	// The counters of removed or moved rules are removed.
+	metricMapper = &mapper.MetricMapper{Logger: promslog.NewNopLogger()}
+	assert.NoError(t, metricMapper.InitFromYAMLString(`mappings:
+- match: foo.*
+  name: foo
+`))
+	c.SetMapper(metricMapper)
+	c.processLine("foo.a 1 1534620625")
+	assert.NoError(t, testutil.CollectAndCompare(c.mappingMatches, strings.NewReader(`
+# HELP graphite_mapping_matches_total Total count of samples matched by each mapping rule, by its index in the mapping configuration and its metric name.
+# TYPE graphite_mapping_matches_total counter
+graphite_mapping_matches_total{name="foo",rule="0"} 1
+`)))
+}
+
+func TestMappingCoverage(t *testing.T) {
+	c := NewGraphiteCollector(promslog.NewNopLogger(), false, 5*time.Minute)
+
+	metricMapper := &mapper.MetricMapper{Logger: promslog.NewNopLogger()}
+	err := metricMapper.InitFromYAMLString(`mappings:
+- match: foo.*
+  name: foo
+  labels:
+    bar: $1
+- match: unused.*
+  name: unused
+`)
+	assert.NoError(t, err)
+	c.SetMapper(metricMapper)
+
+	for _, line := range []string{
+		"foo.a 1 1534620625",
+		"foo.b 1 1534620625",
+		"bar.a;tag=1 1 1534620625",
+		"bar.a;tag=2 1 1534620625",
+		"bar.b 1 1534620625",
+	} {
+		c.processLine(line)
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(c.mappingMatches.WithLabelValues("0", "foo")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(c.mappingMatches.WithLabelValues("2", "unused")))
+
+	rec := httptest.NewRecorder()
+	c.UnmappedHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/unmapped", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"total": 3,
+		"metrics": [
+			{"name": "bar.a", "count": 2, "max_error": 0},
+			{"name": "bar.b", "count": 1, "max_error": 0}
+		]
+	}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	c.UnmappedHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/unmapped?limit=x", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestUnmappedTracker(t *testing.T) {
+	tracker := newUnmappedTracker(2)
+	for _, name := range []string{"a", "a", "a", "b", "c", "c"} {
+		tracker.observe(name)
+	}
+
+	// "c" replaced "b" and inherited its count.
+	top, total := tracker.top(0)
+	assert.Equal(t, uint64(6), total)
+	assert.Equal(t, []UnmappedMetric{
+		{Name: "a", Count: 3},
+		{Name: "c", Count: 3, MaxError: 1},
+	}, top)
+
+	top, _ = tracker.top(1)
+	assert.Equal(t, []UnmappedMetric{{Name: "a", Count: 3}}, top)
+}
+
+func TestSeriesHandler(t *testing.T) {
+	c := NewGraphiteCollector(promslog.NewNopLogger(), false, 5*time.Minute)
+	now := time.Now()
+	for _, s := range []*Sample{
+		{OriginalName: "servers.web-01.cpu", Name: "servers_cpu", Labels: prometheus.Labels{"host": "web-01"}, Value: 1, Timestamp: now},
+		{OriginalName: "servers.web-02.cpu", Name: "servers_cpu", Labels: prometheus.Labels{"host": "web-02"}, Value: 2, Timestamp: now},
+		{OriginalName: "servers.db-01.cpu;env=prod", Name: "servers_cpu", Labels: prometheus.Labels{"host": "db-01", "env": "prod"}, Value: 3, Timestamp: now},
+		{OriginalName: "servers.web-01.memory", Name: "servers_memory", Labels: prometheus.Labels{"host": "web-01"}, Value: 4, Timestamp: now},
+		{OriginalName: "servers.web-03.cpu", Name: "servers_cpu", Labels: prometheus.Labels{"host": "web-03"}, Value: 5, Timestamp: now.Add(-10 * time.Minute)},
+	} {
+		c.samples[s.OriginalName] = s
+	}
+
+	query := func(q string) (int, SeriesResult) {
+		rec := httptest.NewRecorder()
+		c.SeriesHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/series?"+q, nil))
+		var result SeriesResult
+		if rec.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+		}
+		return rec.Code, result
+	}
+	names := func(result SeriesResult) []string {
+		var names []string
+		for _, s := range result.Series {
+			names = append(names, s.OriginalName)
+		}
+		return names
+	}
+
+	for name, testCase := range map[string]struct {
+		query    string
+		expected []string
+		next     string
+	}{
+		"all": {
+			expected: []string{"servers.db-01.cpu;env=prod", "servers.web-01.cpu", "servers.web-01.memory", "servers.web-02.cpu"},
+		},
+		"original glob": {
+			query:    "original=" + url.QueryEscape("servers.web-0[12].{cpu,disk}"),
+			expected: []string{"servers.web-01.cpu", "servers.web-02.cpu"},
+		},
+		"original glob does not cross segments": {
+			query: "original=" + url.QueryEscape("servers.*"),
+		},
+		"name": {
+			query:    "name=servers_memory",
+			expected: []string{"servers.web-01.memory"},
+		},
+		"label matchers": {
+			query:    "label=" + url.QueryEscape("host=~.*-01") + "&label=" + url.QueryEscape("env!=prod"),
+			expected: []string{"servers.web-01.cpu", "servers.web-01.memory"},
+		},
+		"first page": {
+			query:    "limit=2",
+			expected: []string{"servers.db-01.cpu;env=prod", "servers.web-01.cpu"},
+			next:     "servers.web-01.cpu",
+		},
+		"second page": {
+			query:    "limit=2&after=servers.web-01.cpu",
+			expected: []string{"servers.web-01.memory", "servers.web-02.cpu"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			code, result := query(testCase.query)
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, testCase.expected, names(result))
+			assert.Equal(t, testCase.next, result.Next)
+		})
+	}
+
+	_, result := query("name=servers_memory")
+	if assert.Len(t, result.Series, 1) {
+		s := result.Series[0]
+		assert.Equal(t, "4", s.Value)
+		assert.Equal(t, prometheus.Labels{"host": "web-01"}, s.Labels)
+		assert.InDelta(t, 300, s.ExpiresIn, 5)
+	}
+
+	for _, q := range []string{"label=host", "original=%7Ba", "limit=0"} {
+		code, _ := query(q)
+		assert.Equal(t, http.StatusBadRequest, code, q)
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	for glob, testCase := range map[string]struct {
+		matches, nonMatches []string
+	}{
+		"servers.web-0[12].{cpu,disk}": {
+			matches:    []string{"servers.web-01.cpu", "servers.web-02.disk"},
+			nonMatches: []string{"servers.web-03.cpu", "servers.web-01.memory"},
+		},
+		"a.[0-9x].b": {
+			matches:    []string{"a.5.b", "a.x.b"},
+			nonMatches: []string{"a.-.b", "a.y.b"},
+		},
+		"a.[!0-9].b": {
+			matches:    []string{"a.x.b"},
+			nonMatches: []string{"a.5.b", "a...b"},
+		},
+		"a.[]x].b": {
+			matches:    []string{"a.].b", "a.x.b"},
+			nonMatches: []string{"a.[.b"},
+		},
+		`a.[[\^].b`: {
+			matches:    []string{"a.[.b", `a.\.b`, "a.^.b"},
+			nonMatches: []string{"a.x.b"},
+		},
+		"a.[.*].b": {
+			matches:    []string{"a.*.b"},
+			nonMatches: []string{"a.x.b"},
+		},
+	} {
+		re, err := GlobToRegexp(glob)
+		if !assert.NoError(t, err, glob) {
+			continue
+		}
+		for _, m := range testCase.matches {
+			assert.True(t, re.MatchString(m), "%s should match %s", glob, m)
+		}
+		for _, m := range testCase.nonMatches {
+			assert.False(t, re.MatchString(m), "%s should not match %s", glob, m)
+		}
+	}
+
+	for _, glob := range []string{"a.[bc", "a.[]", "a.{b,c"} {
+		_, err := GlobToRegexp(glob)
+		assert.Error(t, err, glob)
+	}
+}
+
+func TestParseInfluxLine(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for line, expected := range map[string]influxLine{
+		"cpu,host=web-01,cpu=cpu0 usage_idle=98.5,usage_user=1i 1700000001000000000": {
+			measurement: "cpu",
+			tags:        map[string]string{"host": "web-01", "cpu": "cpu0"},
+			fields:      map[string]float64{"usage_idle": 98.5, "usage_user": 1},
+			timestamp:   time.Unix(1700000001, 0),
+		},
+		`disk\ io,path=C:\\,label=a\,b\ c reads=3u,ok=true,msg="a, \"b\" c=d",writes=-2e3`: {
+			measurement: "disk io",
+			tags:        map[string]string{"path": `C:\`, "label": "a,b c"},
+			fields:      map[string]float64{"reads": 3, "ok": 1, "writes": -2000},
+			timestamp:   now,
+		},
+	} {
+		l, err := parseInfluxLine(line, time.Nanosecond, now)
+		if assert.NoError(t, err, line) {
+			assert.Equal(t, expected, l, line)
+		}
+	}
+
+	l, err := parseInfluxLine("mem free=1 1700000002", time.Second, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Unix(1700000002, 0), l.timestamp)
+	}
+
+	for _, line := range []string{
+		"cpu",
+		"cpu,host usage=1",
+		"cpu usage=abc",
+		"cpu usage=1 yesterday",
+		"cpu usage=1 1 2",
+		",host=a usage=1",
+	} {
+		_, err := parseInfluxLine(line, time.Nanosecond, now)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestInfluxWriteHandler(t *testing.T) {
+	c := NewGraphiteCollector(promslog.NewNopLogger(), false, 5*time.Minute)
+	metricMapper := &mapper.MetricMapper{Logger: promslog.NewNopLogger()}
+	err := metricMapper.InitFromYAMLString(`mappings:
+- match: 'cpu.*'
+  name: cpu_usage
+  labels:
+    mode: $1
+`)
+	assert.NoError(t, err)
+	c.SetMapper(metricMapper)
+
+	body := strings.NewReader("cpu,host=web-01 idle=98.5,user=1.5 1700000000\n# comment\n\nmem,host=web-01 free=1024i 1700000000\n")
+	req := httptest.NewRequest(http.MethodPost, "/write?db=telegraf&precision=s", body)
+	rec := httptest.NewRecorder()
+	c.InfluxWriteHandler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	sample := func(name string) *Sample {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.samples[name]
+	}
+	assert.Eventually(t, func() bool { return sample("mem.free;host=web-01") != nil }, time.Second, 10*time.Millisecond)
+
+	idle := sample("cpu.idle;host=web-01")
+	if assert.NotNil(t, idle) {
+		assert.Equal(t, "cpu_usage", idle.Name)
+		assert.Equal(t, prometheus.Labels{"host": "web-01", "mode": "idle"}, idle.Labels)
+		assert.Equal(t, 98.5, idle.Value)
+		assert.Equal(t, time.Unix(1700000000, 0), idle.Timestamp)
+	}
+	mem := sample("mem.free;host=web-01")
+	assert.Equal(t, "mem_free", mem.Name)
+	assert.Equal(t, 1024.0, mem.Value)
+
+	req = httptest.NewRequest(http.MethodPost, "/write", strings.NewReader("cpu user=abc\n"))
+	rec = httptest.NewRecorder()
+	c.InfluxWriteHandler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestParseOpenTSDBPut(t *testing.T) {
+	for line, expected := range map[string]point{
+		"put sys.cpu.user 1356998400 42.5 host=webserver01 cpu=0": {
+			originalName: "sys.cpu.user;cpu=0;host=webserver01",
+			value:        42.5,
+			timestamp:    time.Unix(1356998400, 0),
+		},
+		"put sys.cpu.user 1356998400500 1": {
+			originalName: "sys.cpu.user",
+			value:        1,
+			timestamp:    time.UnixMilli(1356998400500),
+		},
+		"put hbase.regionserver.requests 1356998400.25 -3 host.name=rs;1": {
+			originalName: "hbase.regionserver.requests;host.name=rs_1",
+			value:        -3,
+			timestamp:    time.Unix(1356998400, 250000000),
+		},
+	} {
+		p, err := parseOpenTSDBPut(line)
+		if assert.NoError(t, err, line) {
+			assert.Equal(t, expected, p, line)
+		}
+	}
+
+	for _, line := range []string{
+		"put sys.cpu.user 1356998400",
+		"put sys.cpu.user now 1 host=a",
+		"put sys.cpu.user 1356998400 abc host=a",
+		"put sys.cpu.user 1356998400 1 host",
+		"get sys.cpu.user 1356998400 1 host=a",
+	} {
+		_, err := parseOpenTSDBPut(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestOpenTSDBPutHandler(t *testing.T) {
+	c := NewGraphiteCollector(promslog.NewNopLogger(), false, 5*time.Minute)
+	c.mapper = &mockMapper{present: false}
+
+	put := func(query, body string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/put"+query, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c.OpenTSDBPutHandler().ServeHTTP(rec, req)
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+
+	code, _ := put("", `{"metric":"sys.cpu.nice","timestamp":1346846400,"value":18,"tags":{"host":"web01"}}`)
+	assert.Equal(t, http.StatusNoContent, code)
+
+	code, body := put("?summary", `[
+		{"metric":"sys.cpu.nice","timestamp":"1346846400000","value":"9","tags":{"host":"web02"}},
+		{"metric":"sys.cpu.idle","timestamp":1346846400,"value":90,"tags":{"host":"web01"}}
+	]`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"failed":0,"success":2}`, body)
+
+	code, body = put("?details", `[{"metric":"sys.cpu.nice","timestamp":1346846400,"value":"x"}]`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, body, `"error":"invalid value \"x\""`)
+
+	code, _ = put("", `not json`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	sample := func(name string) *Sample {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.samples[name]
+	}
+	assert.Eventually(t, func() bool { return sample("sys.cpu.idle;host=web01") != nil }, time.Second, 10*time.Millisecond)
+	nice := sample("sys.cpu.nice;host=web02")
+	if assert.NotNil(t, nice) {
+		assert.Equal(t, "sys_cpu_nice", nice.Name)
+		assert.Equal(t, prometheus.Labels{"host": "web02"}, nice.Labels)
+		assert.Equal(t, 9.0, nice.Value)
+		assert.Equal(t, time.Unix(1346846400, 0), nice.Timestamp)
+	}
+}
+
+func TestNamingScheme(t *testing.T) {
+	for scheme, expected := range map[NamingScheme][2]string{
+		NamingSchemeLegacy:      {"web_server_foo", "host_name"},
+		NamingSchemeUnderscores: {"web_server_foo", "host_name"},
+		NamingSchemeDots:        {"web__server_dot_foo", "host__name"},
+		NamingSchemeValues:      {"U__web_2d_server_2e_foo", "U__host_2d_name"},
+		NamingSchemeUTF8:        {"web-server.foo", "host-name"},
+	} {
+		assert.Equal(t, expected[0], scheme.MetricName("web-server.foo"), scheme)
+		assert.Equal(t, expected[1], scheme.LabelName("host-name"), scheme)
+	}
+	assert.Equal(t, "my_metric", NamingSchemeDots.MappedName("my_metric"))
+	assert.Equal(t, "_1tag", NamingSchemeUnderscores.LabelName("1tag"))
+
+	c := NewGraphiteCollector(promslog.NewNopLogger(), false, 5*time.Minute)
+	c.mapper = &mockMapper{present: false}
+	c.SetNamingScheme(NamingSchemeUTF8)
+	now := time.Now().Unix()
+	c.processLine(fmt.Sprintf("web-server.foo;host-name=a 1 %d", now))
+	c.processLine(fmt.Sprintf("web_server.foo;host-name=a 2 %d", now))
+	c.sampleCh <- nil
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	scrape := func(accept string) string {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	// The metrics would both be exposed as web_server_foo to scrapers that
+	// do not support UTF-8, so they collide.
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.seriesCollisions))
+	assert.Equal(t, `# HELP "web-server.foo" Graphite metric web-server.foo
+# TYPE "web-server.foo" gauge
+{"web-server.foo","host-name"="a"} 1
+`, exposition(scrape("text/plain;version=1.0.0;escaping=allow-utf-8")))
+	assert.Equal(t, `# HELP web_server_foo Graphite metric web-server.foo
+# TYPE web_server_foo gauge
+web_server_foo{host_name="a"} 1
+`, exposition(scrape("text/plain;version=0.0.4")))
+}
+
+// exposition returns the part of a text exposition that is not about the
+// exporter's own graphite_* metrics.
+func exposition(body string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(body, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "graphite_") ||
+			(fields[0] == "#" && len(fields) > 2 && strings.HasPrefix(fields[2], "graphite_")) {
+			continue
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// recordingSink records the samples it receives.
+type recordingSink struct {
+	exposed, dropped []*Sample
+}
+
+func (r *recordingSink) Append(s *Sample) {
+	if s.Dropped {
+		r.dropped = append(r.dropped, s)
+	} else {
+		r.exposed = append(r.exposed, s)
+	}
+}
+
+func TestSeriesCollisions(t *testing.T) {
+	now := time.Now().Unix()
+	for _, lines := range [][]string{
+		{"a-b.c 1", "a_b.c 2"},
+		{"a_b.c 2", "a-b.c 1"},
+	} {
+		c := NewGraphiteCollector(promslog.NewNopLogger(), false, 5*time.Minute)
+		c.mapper = &mockMapper{present: false}
+		sink := &recordingSink{}
+		c.AddSampleSink(sink)
+		for _, line := range lines {
+			c.processLine(fmt.Sprintf("%s %d", line, now))
+		}
+		c.sampleCh <- nil
+
+		// Both paths result in a_b_c, which used to fail the scrape with
+		// "collected metric ... was collected before with the same name
+		// and label values".
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(c)
+		families, err := registry.Gather()
+		assert.NoError(t, err, lines)
+
+		var values []float64
+		for _, f := range families {
+			if f.GetName() == "a_b_c" {
+				for _, m := range f.GetMetric() {
+					values = append(values, m.GetGauge().GetValue())
+				}
+			}
+		}
+		assert.Equal(t, []float64{1}, values, lines)
+		assert.Equal(t, 1.0, testutil.ToFloat64(c.seriesCollisions), lines)
+		assert.Len(t, c.samples, 1, lines)
+
+		// Sinks only receive a sample as exposed if it was exposed when it
+		// arrived.
+		assert.Equal(t, "a-b.c", sink.exposed[len(sink.exposed)-1].OriginalName, lines)
+		for _, s := range sink.dropped {
+			assert.Equal(t, "a_b.c", s.OriginalName, lines)
+		}
+	}
+
+	// A metric takes over the series once the winner has expired.
+	c := NewGraphiteCollector(promslog.NewNopLogger(), false, 5*time.Minute)
+	c.mapper = &mockMapper{present: false}
+	c.processLine(fmt.Sprintf("a-b.c 1 %d", now-600))
+	c.processLine(fmt.Sprintf("a_b.c 2 %d", now))
+	c.sampleCh <- nil
+	assert.Equal(t, 0.0, testutil.ToFloat64(c.seriesCollisions))
+	assert.Equal(t, 2.0, c.samples["a_b.c"].Value)
+	assert.Equal(t, map[string]string{c.seriesKey(c.samples["a_b.c"]): "a_b.c"}, c.seriesOwners)
+}
+
+func TestLabelConsistency(t *testing.T) {
+	now := time.Now().Unix()
+	lines := []string{
+		"load;host=a;dc=x 1",
+		"load;host=b 2",
+		"load;host=c;dc=y;rack=r1 3",
+		"load;host=d;rack=r2 4",
+	}
+	for _, tc := range []struct {
+		mode     LabelConsistency
+		expected map[string]prometheus.Labels
+		fixes    map[string]float64
+	}{
+		{
+			mode: LabelConsistencyOff,
+			expected: map[string]prometheus.Labels{
+				"load;host=a;dc=x":         {"host": "a", "dc": "x"},
+				"load;host=b":              {"host": "b"},
+				"load;host=c;dc=y;rack=r1": {"host": "c", "dc": "y", "rack": "r1"},
+				"load;host=d;rack=r2":      {"host": "d", "rack": "r2"},
+			},
+			fixes: map[string]float64{labelsFilled: 0, labelsRemoved: 0, labelsDropped: 0},
+		},
+		{
+			mode: LabelConsistencyFill,
+			expected: map[string]prometheus.Labels{
+				"load;host=a;dc=x":         {"host": "a", "dc": "x"},
+				"load;host=b":              {"host": "b", "dc": ""},
+				"load;host=c;dc=y;rack=r1": {"host": "c", "dc": "y"},
+				"load;host=d;rack=r2":      {"host": "d", "dc": ""},
+			},
+			fixes: map[string]float64{labelsFilled: 2, labelsRemoved: 2, labelsDropped: 0},
+		},
+		{
+			mode: LabelConsistencyDrop,
+			expected: map[string]prometheus.Labels{
+				"load;host=a;dc=x": {"host": "a", "dc": "x"},
+			},
+			fixes: map[string]float64{labelsFilled: 0, labelsRemoved: 0, labelsDropped: 3},
+		},
+	} {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			c := NewGraphiteCollector(promslog.NewNopLogger(), false, 5*time.Minute)
+			c.mapper = &mockMapper{present: false}
+			c.SetLabelConsistency(tc.mode)
+			sink := &recordingSink{}
+			c.AddSampleSink(sink)
+			for _, line := range lines {
+				c.processLine(fmt.Sprintf("%s %d", line, now))
+			}
+			c.sampleCh <- nil
+
+			actual := map[string]prometheus.Labels{}
+			for name, s := range c.samples {
+				actual[name] = s.Labels
+			}
+			assert.Equal(t, tc.expected, actual)
+
+			// Sinks receive the samples as they are exposed.
+			actual = map[string]prometheus.Labels{}
+			for _, s := range sink.exposed {
+				actual[s.OriginalName] = s.Labels
+			}
+			assert.Equal(t, tc.expected, actual)
+			assert.Len(t, sink.dropped, len(lines)-len(tc.expected))
+			for action, n := range tc.fixes {
+				assert.Equal(t, n, testutil.ToFloat64(c.labelConsistencyFixes.WithLabelValues(action)), action)
+			}
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(c)
+			_, err := registry.Gather()
+			assert.NoError(t, err)
+		})
+	}
+
+	// The schema is forgotten once all samples using it have expired.
+	c := NewGraphiteCollector(promslog.NewNopLogger(), false, 5*time.Minute)
+	c.mapper = &mockMapper{present: false}
+	c.SetLabelConsistency(LabelConsistencyDrop)
+	c.processLine(fmt.Sprintf("load;host=a 1 %d", now))
+	c.sampleCh <- nil
+	c.mu.Lock()
+	c.deleteLocked("load;host=a")
+	c.mu.Unlock()
+	assert.Empty(t, c.schemas)
+}
+
+func TestHelpAndUnit(t *testing.T) {
+	config := `mappings:
+- match: servers.*.response_time
+  name: server_response_time_seconds
+  help: Time taken to respond to a request.
+  unit: seconds
+  labels:
+    server: $1
+- match: 'disk\.(.*)'
+  match_type: regex
+  match_metric_type: counter
+  name: disk_${1}_total
+  unit: bytes
+- match: 'disk\.(.*)'
+  match_type: regex
+  name: disk_${1}
+  unit: bytes
+- match: 'disk\.(.*)'
+  match_type: regex
+  name: disk_${1}_seconds
+  unit: seconds
+- match: servers.*.load
+  name: server_load
+  labels:
+    server: $1
+- match: hosts.*.load
+  name: server_load
+  help: Load average.
+  labels:
+    server: $1
+- match: servers.*.requests
+  name: server_requests_total
+  cumulative: true
+  labels:
+    server: $1
+`
+	fileName := filepath.Join(t.TempDir(), "mapping.yml")
+	assert.NoError(t, os.WriteFile(fileName, []byte(config), 0o644))
+	metricMapper := &mapper.MetricMapper{Logger: promslog.NewNopLogger()}
+	c := NewGraphiteCollector(promslog.NewNopLogger(), false, 5*time.Minute)
+	assert.NoError(t, c.LoadMappingConfig(metricMapper, fileName))
+	c.SetMapper(metricMapper)
+
+	now := time.Now().Unix()
+	for _, line := range []string{
+		"servers.a.response_time 0.5",
+		"servers.a.load 2",
+		"hosts.b.load 3",
+		"servers.a.requests 7",
+		"disk.used_bytes 100",
+		// The name does not end with the unit, so it is not exposed.
+		"disk.free 100",
+	} {
+		c.processLine(fmt.Sprintf("%s %d", line, now))
+	}
+	c.sampleCh <- nil
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	handler := promhttp.HandlerFor(c.Gatherer(registry), promhttp.HandlerOpts{EnableOpenMetrics: true})
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	body := rec.Body.String()
+
+	assert.Contains(t, body, "# HELP server_response_time_seconds Time taken to respond to a request.\n")
+	assert.Contains(t, body, "# UNIT server_response_time_seconds seconds\n")
+	// Both mappings result in server_load, and hosts.b.load sorts first.
+	assert.Contains(t, body, "# HELP server_load Load average.\n")
+	assert.Contains(t, body, `server_load{server="a"} 2`)
+	assert.NotContains(t, body, "# UNIT server_load")
+	assert.Contains(t, body, "# TYPE server_load gauge\n")
+	assert.Contains(t, body, "# TYPE server_requests counter\n")
+	assert.Contains(t, body, `server_requests_total{server="a"} 7`)
+	assert.Contains(t, body, "# UNIT disk_used_bytes bytes\n")
+	assert.NotContains(t, body, "# UNIT disk_free")
+
+	assert.NoError(t, os.WriteFile(fileName, []byte(`mappings:
+- match: foo.*
+  name: foo_latency
+  unit: seconds
+`), 0o644))
+	err := c.LoadMappingConfig(&mapper.MetricMapper{Logger: promslog.NewNopLogger()}, fileName)
+	assert.EqualError(t, err, `metric name "foo_latency" of mapping "foo.*" does not end with its unit "seconds"`)
+}
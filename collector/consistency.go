@@ -0,0 +1,132 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LabelConsistency determines what happens to samples whose label names
+// differ from those of the first sample exposed with the same metric name.
+type LabelConsistency string
+
+const (
+	// LabelConsistencyOff exposes samples with any label names.
+	LabelConsistencyOff LabelConsistency = "off"
+	// LabelConsistencyFill adds missing labels with empty values and removes
+	// labels that the first sample did not have.
+	LabelConsistencyFill LabelConsistency = "fill"
+	// LabelConsistencyDrop drops samples with different label names.
+	LabelConsistencyDrop LabelConsistency = "drop"
+)
+
+// LabelConsistencies lists the valid label consistency modes.
+var LabelConsistencies = []string{
+	string(LabelConsistencyOff),
+	string(LabelConsistencyFill),
+	string(LabelConsistencyDrop),
+}
+
+// Actions counted by graphite_label_consistency_fixes_total.
+const (
+	labelsFilled  = "filled"
+	labelsRemoved = "removed"
+	labelsDropped = "dropped"
+)
+
+// labelSchema is the set of label names of a metric name, along with the
+// number of stored samples that use the metric name.
+type labelSchema struct {
+	labels map[string]struct{}
+	refs   int
+}
+
+// SetLabelConsistency sets how samples with inconsistent label names are
+// handled.
+func (c *graphiteCollector) SetLabelConsistency(mode LabelConsistency) {
+	c.labelConsistency = mode
+}
+
+// conformLocked makes the labels of a sample consistent with the schema of its
+// metric name. It returns the sample to store, which is a copy if labels were
+// changed, or nil if the sample is dropped.
+func (c *graphiteCollector) conformLocked(sample *Sample) *Sample {
+	if c.labelConsistency == LabelConsistencyOff {
+		return sample
+	}
+	schema, ok := c.schemas[sample.Name]
+	if !ok {
+		return sample
+	}
+
+	var missing, extra int
+	for name := range schema.labels {
+		if _, ok := sample.Labels[name]; !ok {
+			missing++
+		}
+	}
+	for name := range sample.Labels {
+		if _, ok := schema.labels[name]; !ok {
+			extra++
+		}
+	}
+	if missing == 0 && extra == 0 {
+		return sample
+	}
+
+	if c.labelConsistency == LabelConsistencyDrop {
+		c.labelConsistencyFixes.WithLabelValues(labelsDropped).Inc()
+		c.logger.Debug("Dropped sample with inconsistent labels", "metric", sample.OriginalName, "labels", sample.Labels)
+		return nil
+	}
+
+	conformed := *sample
+	conformed.Labels = make(prometheus.Labels, len(schema.labels))
+	for name := range schema.labels {
+		conformed.Labels[name] = sample.Labels[name]
+	}
+	if missing > 0 {
+		c.labelConsistencyFixes.WithLabelValues(labelsFilled).Inc()
+	}
+	if extra > 0 {
+		c.labelConsistencyFixes.WithLabelValues(labelsRemoved).Inc()
+	}
+	return &conformed
+}
+
+// refSchemaLocked records that a stored sample uses the schema of its metric
+// name, creating the schema from its labels if there is none yet.
+func (c *graphiteCollector) refSchemaLocked(sample *Sample) {
+	schema, ok := c.schemas[sample.Name]
+	if !ok {
+		schema = &labelSchema{labels: make(map[string]struct{}, len(sample.Labels))}
+		for name := range sample.Labels {
+			schema.labels[name] = struct{}{}
+		}
+		c.schemas[sample.Name] = schema
+	}
+	schema.refs++
+}
+
+// unrefSchemaLocked forgets the schema of a metric name once no stored sample
+// uses it.
+func (c *graphiteCollector) unrefSchemaLocked(sample *Sample) {
+	schema, ok := c.schemas[sample.Name]
+	if !ok {
+		return
+	}
+	if schema.refs--; schema.refs <= 0 {
+		delete(c.schemas, sample.Name)
+	}
+}
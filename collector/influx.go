@@ -0,0 +1,256 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultInfluxTemplate turns an Influx measurement and field into a Graphite
+// path.
+const DefaultInfluxTemplate = "{measurement}.{field}"
+
+// influxLine is a parsed line of the InfluxDB line protocol. Only numeric and
+// boolean fields are kept.
+type influxLine struct {
+	measurement string
+	tags        map[string]string
+	fields      map[string]float64
+	timestamp   time.Time
+}
+
+// splitUnescaped splits s at each sep that is not escaped with a backslash
+// and, if quoted is set, not inside a double-quoted string.
+func splitUnescaped(s string, sep byte, quoted bool) []string {
+	var (
+		parts    []string
+		start    int
+		inQuotes bool
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"' && quoted:
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+var influxUnescaper = strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ", `\"`, `"`, `\\`, `\`)
+
+// splitKeyValue splits an unescaped key=value pair.
+func splitKeyValue(s string) (string, string, error) {
+	kv := splitUnescaped(s, '=', true)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return "", "", fmt.Errorf("invalid key value pair %q", s)
+	}
+	return influxUnescaper.Replace(kv[0]), kv[1], nil
+}
+
+// parseInfluxFieldValue parses a field value. String fields are reported as
+// not ok.
+func parseInfluxFieldValue(s string) (float64, bool, error) {
+	switch s {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		return 0, false, nil
+	}
+	if v, ok := strings.CutSuffix(s, "i"); ok {
+		i, err := strconv.ParseInt(v, 10, 64)
+		return float64(i), err == nil, err
+	}
+	if v, ok := strings.CutSuffix(s, "u"); ok {
+		u, err := strconv.ParseUint(v, 10, 64)
+		return float64(u), err == nil, err
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil, err
+}
+
+// parseInfluxLine parses a line of the InfluxDB line protocol. The timestamp
+// is in units of precision; lines without one get the current time.
+func parseInfluxLine(line string, precision time.Duration, now time.Time) (influxLine, error) {
+	sections := splitUnescaped(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return influxLine{}, errors.New("expected measurement, fields and optional timestamp")
+	}
+
+	series := splitUnescaped(sections[0], ',', false)
+	l := influxLine{
+		measurement: influxUnescaper.Replace(series[0]),
+		tags:        map[string]string{},
+		fields:      map[string]float64{},
+		timestamp:   now,
+	}
+	if l.measurement == "" {
+		return influxLine{}, errors.New("missing measurement")
+	}
+	for _, tag := range series[1:] {
+		k, v, err := splitKeyValue(tag)
+		if err != nil {
+			return influxLine{}, err
+		}
+		l.tags[k] = influxUnescaper.Replace(v)
+	}
+
+	for _, field := range splitUnescaped(sections[1], ',', true) {
+		k, v, err := splitKeyValue(field)
+		if err != nil {
+			return influxLine{}, err
+		}
+		value, ok, err := parseInfluxFieldValue(v)
+		if err != nil {
+			return influxLine{}, fmt.Errorf("invalid value for field %q: %w", k, err)
+		}
+		if ok {
+			l.fields[k] = value
+		}
+	}
+
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return influxLine{}, fmt.Errorf("invalid timestamp: %w", err)
+		}
+		l.timestamp = time.Unix(0, ts*int64(precision))
+	}
+	return l, nil
+}
+
+// points converts a parsed line into one point per field. The Graphite path
+// is built from the template.
+func (l influxLine) points(template string) []point {
+	points := make([]point, 0, len(l.fields))
+	for field, value := range l.fields {
+		path := strings.NewReplacer("{measurement}", l.measurement, "{field}", field).Replace(template)
+		points = append(points, point{
+			originalName: taggedPath(path, l.tags),
+			value:        value,
+			timestamp:    l.timestamp,
+		})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].originalName < points[j].originalName })
+	return points
+}
+
+// SetInfluxTemplate sets the template that turns an Influx measurement and
+// field into a Graphite path. "{measurement}" and "{field}" are replaced with
+// their names.
+func (c *graphiteCollector) SetInfluxTemplate(template string) {
+	c.influxTemplate = template
+}
+
+// processInflux processes InfluxDB line protocol from a reader. It returns
+// the number of invalid lines and the first parse error.
+func (c *graphiteCollector) processInflux(reader io.Reader, precision time.Duration) (int, error) {
+	var (
+		invalid  int
+		firstErr error
+	)
+	lineScanner := bufio.NewScanner(reader)
+	for lineScanner.Scan() {
+		line := strings.TrimSpace(lineScanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		l, err := parseInfluxLine(line, precision, time.Now())
+		if err != nil {
+			c.logger.Info("Invalid Influx line", "line", line, "err", err)
+			invalid++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("invalid line %q: %w", line, err)
+			}
+			continue
+		}
+		for _, p := range l.points(c.influxTemplate) {
+			c.pointCh <- p
+		}
+	}
+	if err := lineScanner.Err(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return invalid, firstErr
+}
+
+// ProcessInfluxReader processes InfluxDB line protocol with nanosecond
+// timestamps from a reader.
+func (c *graphiteCollector) ProcessInfluxReader(reader io.Reader) {
+	c.processInflux(reader, time.Nanosecond)
+}
+
+var influxPrecisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"n":  time.Nanosecond,
+	"ns": time.Nanosecond,
+	"u":  time.Microsecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// InfluxWriteHandler returns an HTTP handler compatible with the InfluxDB 1.x
+// /write endpoint. The "precision" parameter sets the timestamp unit; other
+// parameters such as the database are ignored.
+func (c *graphiteCollector) InfluxWriteHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		precision, ok := influxPrecisions[r.URL.Query().Get("precision")]
+		if !ok {
+			http.Error(w, fmt.Sprintf("invalid precision %q", r.URL.Query().Get("precision")), http.StatusBadRequest)
+			return
+		}
+
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer gz.Close()
+			body = gz
+		}
+
+		if _, err := c.processInflux(body, precision); err != nil {
+			// Valid lines have been processed, like InfluxDB does for
+			// partial writes.
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
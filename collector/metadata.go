@@ -0,0 +1,182 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+	"go.yaml.in/yaml/v2"
+)
+
+// mappingOptionsConfig is the part of the mapping configuration that the
+// statsd exporter mapper does not know about.
+type mappingOptionsConfig struct {
+	Mappings []struct {
+		Match      string `yaml:"match"`
+		Name       string `yaml:"name"`
+		Unit       string `yaml:"unit"`
+		Cumulative bool   `yaml:"cumulative"`
+	} `yaml:"mappings"`
+}
+
+// mappingKey identifies a mapping that the mapper can return for Graphite
+// metrics. The mapper returns copies of its mappings, with the name expanded,
+// so they cannot be told apart by pointer. Of the mappings with the same
+// match type and match, it uses the first one that applies to gauges.
+type mappingKey struct {
+	matchType mapper.MatchType
+	match     string
+}
+
+// graphiteMappings returns, for each mapping that the mapper can return for
+// Graphite metrics, its index in the mappings of m.
+func graphiteMappings(m *mapper.MetricMapper) map[mappingKey]int {
+	indexes := map[mappingKey]int{}
+	for i, mapping := range m.Mappings {
+		if mt := mapping.MatchMetricType; mt != "" && mt != mapper.MetricTypeGauge {
+			continue
+		}
+		key := mappingKey{matchType: mapping.MatchType, match: mapping.Match}
+		if _, ok := indexes[key]; !ok {
+			indexes[key] = i
+		}
+	}
+	return indexes
+}
+
+// keyOf returns the key of a mapping returned by the mapper.
+func keyOf(mapping *mapper.MetricMapping) mappingKey {
+	return mappingKey{matchType: mapping.MatchType, match: mapping.Match}
+}
+
+// mappingOptions are the options of a mapping that the statsd exporter mapper
+// does not know about.
+type mappingOptions struct {
+	unit string
+	// cumulative is true if the values of the metric are counts that only
+	// go up, except when the source restarts.
+	cumulative bool
+}
+
+// mappingsOptions holds the options of the mappings of a mapper.
+type mappingsOptions map[mappingKey]mappingOptions
+
+// newMappingsOptions reads the options of the mappings of m from config, the
+// configuration m was initialized from. A unit must be a suffix of the metric
+// name, as OpenMetrics requires. For names with templates, this is checked
+// when the metric is exposed instead.
+func newMappingsOptions(m *mapper.MetricMapper, config []byte) (mappingsOptions, error) {
+	var cfg mappingOptionsConfig
+	if err := yaml.Unmarshal(config, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Mappings) != len(m.Mappings) {
+		return nil, fmt.Errorf("mapper has %d mappings, configuration has %d", len(m.Mappings), len(cfg.Mappings))
+	}
+	for _, c := range cfg.Mappings {
+		if c.Unit != "" && !strings.Contains(c.Name, "$") && !hasUnitSuffix(c.Name, c.Unit) {
+			return nil, fmt.Errorf("metric name %q of mapping %q does not end with its unit %q", c.Name, c.Match, c.Unit)
+		}
+	}
+	options := mappingsOptions{}
+	for key, i := range graphiteMappings(m) {
+		options[key] = mappingOptions{unit: cfg.Mappings[i].Unit, cumulative: cfg.Mappings[i].Cumulative}
+	}
+	return options, nil
+}
+
+// get returns the options of a mapping returned by the mapper.
+func (o mappingsOptions) get(mapping *mapper.MetricMapping) mappingOptions {
+	return o[keyOf(mapping)]
+}
+
+func hasUnitSuffix(name, unit string) bool {
+	name = strings.TrimSuffix(name, "_total")
+	return strings.HasSuffix(name, "_"+unit)
+}
+
+// LoadMappingConfig initializes the mapper from a mapping configuration file,
+// and reads the units and other options of its mappings. It must be called before samples are
+// processed.
+func (c *graphiteCollector) LoadMappingConfig(m *mapper.MetricMapper, fileName string) error {
+	config, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	if err := m.InitFromYAMLString(string(config)); err != nil {
+		return err
+	}
+	options, err := newMappingsOptions(m, config)
+	if err != nil {
+		return err
+	}
+	c.mappingOptions = options
+	return nil
+}
+
+// metadata is the help text, unit and type of a metric name.
+type metadata struct {
+	originalName string
+	help         string
+	unit         string
+	valueType    prometheus.ValueType
+}
+
+// metadataLocked returns the metadata of each metric name that has not
+// expired. Samples with the same name may come from mappings with different
+// metadata, but a metric family can only have one. Like for colliding series,
+// the sample with the lowest original name wins.
+func (c *graphiteCollector) metadataLocked() map[string]metadata {
+	ageLimit := time.Now().Add(-c.sampleExpiry)
+	result := map[string]metadata{}
+	for _, s := range c.samples {
+		if ageLimit.After(s.Timestamp) {
+			continue
+		}
+		if md, ok := result[s.Name]; ok && md.originalName < s.OriginalName {
+			continue
+		}
+		result[s.Name] = metadata{originalName: s.OriginalName, help: s.Help, unit: s.Unit, valueType: s.Type}
+	}
+	return result
+}
+
+// Gatherer wraps a gatherer that includes the collector, and adds the units of
+// mapped metrics to the gathered metric families. The Prometheus client does
+// not support units otherwise.
+func (c *graphiteCollector) Gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+
+		c.mu.Lock()
+		md := c.metadataLocked()
+		c.mu.Unlock()
+
+		for _, f := range families {
+			m, ok := md[f.GetName()]
+			if !ok || m.unit == "" || !hasUnitSuffix(f.GetName(), m.unit) {
+				continue
+			}
+			unit := m.unit
+			f.Unit = &unit
+		}
+		return families, err
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// NamingScheme determines how Graphite paths and tag keys are turned into
+// Prometheus metric and label names.
+type NamingScheme string
+
+const (
+	// NamingSchemeLegacy replaces characters that are not valid in metric
+	// names with underscores. Label names are made valid the same way.
+	NamingSchemeLegacy NamingScheme = "legacy"
+	// NamingSchemeUnderscores is the Prometheus underscore escaping, which
+	// also makes names that start with a digit valid.
+	NamingSchemeUnderscores NamingScheme = "underscores"
+	// NamingSchemeDots is the Prometheus dots escaping: dots become _dot_,
+	// underscores become __ and other invalid characters become __.
+	NamingSchemeDots NamingScheme = "dots"
+	// NamingSchemeValues is the Prometheus value encoding escaping, which can
+	// be reversed.
+	NamingSchemeValues NamingScheme = "values"
+	// NamingSchemeUTF8 keeps names as they are. Scrapers that do not support
+	// UTF-8 names get them escaped according to content negotiation.
+	NamingSchemeUTF8 NamingScheme = "utf8"
+)
+
+// NamingSchemes lists the valid naming schemes.
+var NamingSchemes = []string{
+	string(NamingSchemeLegacy),
+	string(NamingSchemeUnderscores),
+	string(NamingSchemeDots),
+	string(NamingSchemeValues),
+	string(NamingSchemeUTF8),
+}
+
+func (s NamingScheme) escapingScheme() model.EscapingScheme {
+	switch s {
+	case NamingSchemeUnderscores:
+		return model.UnderscoreEscaping
+	case NamingSchemeDots:
+		return model.DotsEscaping
+	case NamingSchemeValues:
+		return model.ValueEncodingEscaping
+	}
+	return model.NoEscaping
+}
+
+// MetricName turns a Graphite path into a metric name.
+func (s NamingScheme) MetricName(path string) string {
+	switch s {
+	case NamingSchemeUTF8:
+		return strings.ToValidUTF8(path, "_")
+	case NamingSchemeUnderscores, NamingSchemeDots, NamingSchemeValues:
+		return model.EscapeName(path, s.escapingScheme())
+	}
+	return invalidMetricChars.ReplaceAllString(path, "_")
+}
+
+// MappedName makes a metric name from the mapping configuration valid. Unlike
+// MetricName, it does not escape names that are already valid.
+func (s NamingScheme) MappedName(name string) string {
+	if s == NamingSchemeUTF8 {
+		return strings.ToValidUTF8(name, "_")
+	}
+	return invalidMetricChars.ReplaceAllString(name, "_")
+}
+
+// LabelName turns a tag key into a label name.
+func (s NamingScheme) LabelName(key string) string {
+	switch s {
+	case NamingSchemeUTF8:
+		return strings.ToValidUTF8(key, "_")
+	case NamingSchemeDots, NamingSchemeValues:
+		key = model.EscapeName(key, s.escapingScheme())
+	}
+	// Metric names may contain colons, label names may not.
+	return sanitizeLabelName(key)
+}
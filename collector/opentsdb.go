@@ -0,0 +1,206 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseOpenTSDBTimestamp parses a timestamp in seconds or, if it has more
+// than 10 digits, milliseconds. Seconds may have a fractional part.
+func parseOpenTSDBTimestamp(s string) (time.Time, error) {
+	if strings.Contains(s, ".") {
+		ts, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+		}
+		sec, frac := math.Modf(ts)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	ts, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || ts < 0 {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	if len(s) > 10 {
+		return time.UnixMilli(ts), nil
+	}
+	return time.Unix(ts, 0), nil
+}
+
+// openTSDBPoint converts an OpenTSDB data point into a point. The metric
+// name is used as the Graphite path and the tags as Graphite tags.
+func openTSDBPoint(metric, timestamp, value string, tags map[string]string) (point, error) {
+	if metric == "" {
+		return point{}, errors.New("missing metric name")
+	}
+	ts, err := parseOpenTSDBTimestamp(timestamp)
+	if err != nil {
+		return point{}, err
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return point{}, fmt.Errorf("invalid value %q", value)
+	}
+	return point{originalName: taggedPath(metric, tags), value: v, timestamp: ts}, nil
+}
+
+// parseOpenTSDBPut parses a telnet style "put <metric> <timestamp> <value>
+// <tagk=tagv>..." line.
+func parseOpenTSDBPut(line string) (point, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[0] != "put" {
+		return point{}, errors.New("expected put <metric> <timestamp> <value> <tagk=tagv>...")
+	}
+	tags := map[string]string{}
+	for _, tag := range fields[4:] {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok || k == "" || v == "" {
+			return point{}, fmt.Errorf("invalid tag %q", tag)
+		}
+		tags[k] = v
+	}
+	return openTSDBPoint(fields[1], fields[2], fields[3], tags)
+}
+
+// ProcessOpenTSDBReader processes OpenTSDB telnet style put lines from a
+// reader. Other commands are ignored.
+func (c *graphiteCollector) ProcessOpenTSDBReader(reader io.Reader) {
+	lineScanner := bufio.NewScanner(reader)
+	for lineScanner.Scan() {
+		line := strings.TrimSpace(lineScanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "put ") {
+			c.logger.Debug("Ignoring OpenTSDB command", "line", line)
+			continue
+		}
+		p, err := parseOpenTSDBPut(line)
+		if err != nil {
+			c.logger.Info("Invalid OpenTSDB put", "line", line, "err", err)
+			continue
+		}
+		c.pointCh <- p
+	}
+}
+
+// openTSDBDataPoint is a data point of the OpenTSDB /api/put endpoint. The
+// timestamp and value may be numbers or strings.
+type openTSDBDataPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp json.RawMessage   `json:"timestamp"`
+	Value     json.RawMessage   `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+type openTSDBError struct {
+	DataPoint openTSDBDataPoint `json:"datapoint"`
+	Error     string            `json:"error"`
+}
+
+type openTSDBPutSummary struct {
+	Failed  int             `json:"failed"`
+	Success int             `json:"success"`
+	Errors  []openTSDBError `json:"errors,omitempty"`
+}
+
+// jsonScalar returns a JSON number or string as a string.
+func jsonScalar(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// OpenTSDBPutHandler returns an HTTP handler compatible with the OpenTSDB
+// /api/put endpoint. It accepts a single data point or an array of them, and
+// supports the "summary" and "details" parameters.
+func (c *graphiteCollector) OpenTSDBPutHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer gz.Close()
+			body = gz
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var dataPoints []openTSDBDataPoint
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+			var dp openTSDBDataPoint
+			err = json.Unmarshal(trimmed, &dp)
+			dataPoints = append(dataPoints, dp)
+		} else {
+			err = json.Unmarshal(trimmed, &dataPoints)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid JSON: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		var summary openTSDBPutSummary
+		for _, dp := range dataPoints {
+			p, err := openTSDBPoint(dp.Metric, jsonScalar(dp.Timestamp), jsonScalar(dp.Value), dp.Tags)
+			if err != nil {
+				summary.Failed++
+				summary.Errors = append(summary.Errors, openTSDBError{DataPoint: dp, Error: err.Error()})
+				continue
+			}
+			summary.Success++
+			c.pointCh <- p
+		}
+
+		query := r.URL.Query()
+		status := http.StatusNoContent
+		if summary.Failed > 0 {
+			status = http.StatusBadRequest
+		} else if query.Has("summary") || query.Has("details") {
+			status = http.StatusOK
+		}
+		if status == http.StatusNoContent {
+			w.WriteHeader(status)
+			return
+		}
+		if !query.Has("details") {
+			summary.Errors = nil
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(summary)
+	})
+}
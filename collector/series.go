@@ -0,0 +1,255 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+const defaultSeriesLimit = 1000
+
+// Series describes a stored sample as returned by the series endpoint.
+type Series struct {
+	OriginalName string            `json:"original_name"`
+	Name         string            `json:"name"`
+	Labels       prometheus.Labels `json:"labels"`
+	Value        string            `json:"value"`
+	Timestamp    time.Time         `json:"timestamp"`
+	ExpiresIn    float64           `json:"expires_in_seconds"`
+}
+
+// SeriesResult is a page of series.
+type SeriesResult struct {
+	Total  int      `json:"total"`
+	Series []Series `json:"series"`
+	// Next is the value of the "after" parameter for the next page.
+	Next string `json:"next,omitempty"`
+}
+
+// seriesFilter selects stored samples by Graphite path, metric name and
+// label matchers.
+type seriesFilter struct {
+	original *regexp.Regexp
+	name     string
+	matchers []*labels.Matcher
+}
+
+func (f seriesFilter) matches(s *Sample) bool {
+	if f.original != nil {
+		path, _, _ := strings.Cut(s.OriginalName, ";")
+		if !f.original.MatchString(path) {
+			return false
+		}
+	}
+	if f.name != "" && f.name != s.Name {
+		return false
+	}
+	for _, m := range f.matchers {
+		if !m.Matches(s.Labels[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// GlobToRegexp converts a Graphite glob into a regular expression. "*" and
+// "?" do not match across path segments, "{a,b}" matches either alternative
+// and "[...]" matches a character class.
+func GlobToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	inBraces := false
+	for i := 0; i < len(glob); i++ {
+		switch ch := glob[i]; {
+		case ch == '*':
+			b.WriteString(`[^.]*`)
+		case ch == '?':
+			b.WriteString(`[^.]`)
+		case ch == '{' && !inBraces:
+			inBraces = true
+			b.WriteString("(?:")
+		case ch == '}' && inBraces:
+			inBraces = false
+			b.WriteString(")")
+		case ch == ',' && inBraces:
+			b.WriteString("|")
+		case ch == '[':
+			end, err := writeCharClass(&b, glob, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	if inBraces {
+		return nil, fmt.Errorf("unterminated alternative in %q", glob)
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// writeCharClass writes the character class of a glob that starts at index
+// start as a regular expression, and returns the index of its closing "]".
+// Like in Graphite, "!" negates the class, a "]" right after the opening "["
+// or "!" is literal, and all other characters except "-" for ranges are
+// literal. A negated class does not match ".", which separates segments.
+func writeCharClass(b *strings.Builder, glob string, start int) (int, error) {
+	i := start + 1
+	negated := i < len(glob) && glob[i] == '!'
+	if negated {
+		i++
+	}
+	first := i
+	if i < len(glob) && glob[i] == ']' {
+		i++
+	}
+	end := strings.IndexByte(glob[i:], ']')
+	if end < 0 {
+		return 0, fmt.Errorf("unterminated character class in %q", glob)
+	}
+	end += i
+
+	b.WriteString("[")
+	if negated {
+		b.WriteString(`^.`)
+	}
+	for _, r := range glob[first:end] {
+		if r == '-' {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteString(regexp.QuoteMeta(string(r)))
+	}
+	b.WriteString("]")
+	return end, nil
+}
+
+// parseLabelMatcher parses a matcher of the form <label><op><value>, where op
+// is one of =, !=, =~ and !~.
+func parseLabelMatcher(s string) (*labels.Matcher, error) {
+	i := strings.IndexAny(s, "=!")
+	if i <= 0 {
+		return nil, fmt.Errorf("invalid label matcher %q", s)
+	}
+	name, rest := s[:i], s[i:]
+	for _, op := range []struct {
+		op string
+		t  labels.MatchType
+	}{
+		{"=~", labels.MatchRegexp},
+		{"!~", labels.MatchNotRegexp},
+		{"!=", labels.MatchNotEqual},
+		{"=", labels.MatchEqual},
+	} {
+		if v, ok := strings.CutPrefix(rest, op.op); ok {
+			return labels.NewMatcher(op.t, name, v)
+		}
+	}
+	return nil, fmt.Errorf("invalid label matcher %q", s)
+}
+
+// series returns the stored samples that match the filter and have not
+// expired, ordered by their Graphite name. It returns at most limit series
+// with an original name greater than after.
+func (c *graphiteCollector) series(f seriesFilter, after string, limit int) SeriesResult {
+	c.mu.Lock()
+	samples := make([]*Sample, 0, len(c.samples))
+	for _, sample := range c.samples {
+		if f.matches(sample) {
+			samples = append(samples, sample)
+		}
+	}
+	c.mu.Unlock()
+
+	now := time.Now()
+	ageLimit := now.Add(-c.sampleExpiry)
+	live := samples[:0]
+	for _, s := range samples {
+		if !ageLimit.After(s.Timestamp) {
+			live = append(live, s)
+		}
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].OriginalName < live[j].OriginalName })
+
+	result := SeriesResult{Total: len(live), Series: []Series{}}
+	start := sort.Search(len(live), func(i int) bool { return live[i].OriginalName > after })
+	for _, s := range live[start:] {
+		if len(result.Series) == limit {
+			result.Next = result.Series[len(result.Series)-1].OriginalName
+			break
+		}
+		result.Series = append(result.Series, Series{
+			OriginalName: s.OriginalName,
+			Name:         s.Name,
+			Labels:       s.Labels,
+			Value:        strconv.FormatFloat(s.Value, 'g', -1, 64),
+			Timestamp:    s.Timestamp,
+			ExpiresIn:    s.Timestamp.Add(c.sampleExpiry).Sub(now).Seconds(),
+		})
+	}
+	return result
+}
+
+// SeriesHandler returns an HTTP handler that lists the stored samples. They
+// can be filtered by a glob on the Graphite path ("original"), the metric
+// name ("name") and label matchers such as "job=~api.*" ("label", may be
+// repeated). Results are paginated with "limit" and "after".
+func (c *graphiteCollector) SeriesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var (
+			f   = seriesFilter{name: r.Form.Get("name")}
+			err error
+		)
+		if g := r.Form.Get("original"); g != "" {
+			if f.original, err = GlobToRegexp(g); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		for _, l := range r.Form["label"] {
+			m, err := parseLabelMatcher(l)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			f.matchers = append(f.matchers, m)
+		}
+
+		limit := defaultSeriesLimit
+		if l := r.Form.Get("limit"); l != "" {
+			if limit, err = strconv.Atoi(l); err != nil || limit <= 0 {
+				http.Error(w, fmt.Sprintf("invalid limit %q", l), http.StatusBadRequest)
+				return
+			}
+		}
+
+		writeJSON(w, c.series(f, r.Form.Get("after"), limit))
+	})
+}
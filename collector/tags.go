@@ -0,0 +1,144 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons for which a tag is invalid, as reported by graphite_tag_errors_total.
+const (
+	// The tag has no "=".
+	tagReasonMissingSeparator = "missing_separator"
+	tagReasonEmptyKey         = "empty_key"
+	tagReasonEmptyValue       = "empty_value"
+	// The key contains "!" or "^", which Graphite does not allow.
+	tagReasonInvalidKey = "invalid_key"
+	// The value starts with "~", which Graphite does not allow.
+	tagReasonInvalidValue = "invalid_value"
+	// The key is "name", which Graphite derives from the path, or starts
+	// with "__", which is reserved for internal labels.
+	tagReasonReservedKey = "reserved_key"
+	// The key is not a valid label name and was escaped according to the
+	// naming scheme.
+	tagReasonSanitizedKey = "sanitized_key"
+	// The key was given more than once. The last value is used.
+	tagReasonDuplicateKey = "duplicate_key"
+)
+
+var tagErrorReasons = []string{
+	tagReasonMissingSeparator,
+	tagReasonEmptyKey,
+	tagReasonEmptyValue,
+	tagReasonInvalidKey,
+	tagReasonInvalidValue,
+	tagReasonReservedKey,
+	tagReasonSanitizedKey,
+	tagReasonDuplicateKey,
+}
+
+// tagError is an invalid tag and the reason it is invalid.
+type tagError struct {
+	tag    string
+	reason string
+}
+
+func (e tagError) Error() string {
+	return fmt.Sprintf("%s in tag %q", strings.ReplaceAll(e.reason, "_", " "), e.tag)
+}
+
+// tagErrors are all invalid tags of a metric.
+type tagErrors []tagError
+
+func (e tagErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+var invalidLabelChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// sanitizeLabelName turns a tag key into a valid label name.
+func sanitizeLabelName(key string) string {
+	name := invalidLabelChars.ReplaceAllString(key, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+func (c *graphiteCollector) parseMetricNameAndTags(name string) (string, prometheus.Labels, error) {
+	return ParseMetricNameAndTags(name, c.namingScheme)
+}
+
+// ParseMetricNameAndTags splits a Graphite path of the form
+// name;tag1=value1;tag2=value2 into the name and labels, following the
+// Graphite tag specification. Values may contain "=". Invalid tags are
+// reported as tagErrors; see the tagReason constants for how each is handled.
+// Tag keys are turned into label names by the naming scheme.
+func ParseMetricNameAndTags(name string, scheme NamingScheme) (string, prometheus.Labels, error) {
+	var errs tagErrors
+
+	labels := make(prometheus.Labels)
+
+	parts := strings.Split(name, ";")
+	parsedName := parts[0]
+
+	for _, tag := range parts[1:] {
+		k, v, ok := strings.Cut(tag, "=")
+		var reason string
+		switch {
+		case !ok:
+			reason = tagReasonMissingSeparator
+		case k == "":
+			reason = tagReasonEmptyKey
+		case v == "":
+			reason = tagReasonEmptyValue
+		case strings.ContainsAny(k, "!^"):
+			reason = tagReasonInvalidKey
+		case strings.HasPrefix(v, "~"):
+			reason = tagReasonInvalidValue
+		}
+		if reason == "" {
+			if label := scheme.LabelName(k); label != k {
+				errs = append(errs, tagError{tag: tag, reason: tagReasonSanitizedKey})
+				k = label
+			}
+			if k == "name" || strings.HasPrefix(k, "__") {
+				reason = tagReasonReservedKey
+			}
+		}
+		if reason != "" {
+			// don't add this tag, continue processing tags but return an error
+			errs = append(errs, tagError{tag: tag, reason: reason})
+			continue
+		}
+
+		if _, ok := labels[k]; ok {
+			errs = append(errs, tagError{tag: tag, reason: tagReasonDuplicateKey})
+		}
+		labels[k] = v
+	}
+
+	if len(errs) > 0 {
+		return parsedName, labels, errs
+	}
+	return parsedName, labels, nil
+}
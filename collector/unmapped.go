@@ -0,0 +1,95 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sort"
+	"sync"
+)
+
+// unmappedTopK is the number of distinct unmapped metric names tracked.
+const unmappedTopK = 100
+
+// UnmappedMetric is an approximate count of samples received for a metric
+// name that no mapping matched. Count may overestimate the true count by up
+// to MaxError.
+type UnmappedMetric struct {
+	Name     string `json:"name"`
+	Count    uint64 `json:"count"`
+	MaxError uint64 `json:"max_error"`
+}
+
+// unmappedTracker keeps the most frequent unmapped metric names in bounded
+// memory using the Space-Saving algorithm: once full, a new name replaces the
+// least frequent one and inherits its count as the error bound.
+type unmappedTracker struct {
+	mu       sync.Mutex
+	capacity int
+	total    uint64
+	entries  map[string]*UnmappedMetric
+}
+
+func newUnmappedTracker(capacity int) *unmappedTracker {
+	return &unmappedTracker{
+		capacity: capacity,
+		entries:  make(map[string]*UnmappedMetric, capacity),
+	}
+}
+
+func (t *unmappedTracker) observe(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.total++
+	if e, ok := t.entries[name]; ok {
+		e.Count++
+		return
+	}
+	if len(t.entries) < t.capacity {
+		t.entries[name] = &UnmappedMetric{Name: name, Count: 1}
+		return
+	}
+
+	var least *UnmappedMetric
+	for _, e := range t.entries {
+		if least == nil || e.Count < least.Count {
+			least = e
+		}
+	}
+	delete(t.entries, least.Name)
+	t.entries[name] = &UnmappedMetric{Name: name, Count: least.Count + 1, MaxError: least.Count}
+}
+
+// top returns up to limit tracked names, most frequent first, and the total
+// number of unmapped samples observed.
+func (t *unmappedTracker) top(limit int) ([]UnmappedMetric, uint64) {
+	t.mu.Lock()
+	result := make([]UnmappedMetric, 0, len(t.entries))
+	for _, e := range t.entries {
+		result = append(result, *e)
+	}
+	total := t.total
+	t.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	if limit > 0 && limit < len(result) {
+		result = result[:limit]
+	}
+	return result, total
+}
@@ -0,0 +1,131 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type httpClient struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPClient(cfg Config) *httpClient {
+	return &httpClient{url: cfg.Endpoint, client: &http.Client{}}
+}
+
+func (c *httpClient) export(ctx context.Context, req *collectorpb.ExportMetricsServiceRequest) error {
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("User-Agent", "graphite_exporter")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode/100 == 2 {
+		var exportResp collectorpb.ExportMetricsServiceResponse
+		if err := proto.Unmarshal(body, &exportResp); err == nil {
+			return checkPartialSuccess(exportResp.GetPartialSuccess())
+		}
+		return nil
+	}
+	err = fmt.Errorf("server returned HTTP status %s", resp.Status)
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return recoverableError{err}
+	}
+	return err
+}
+
+func (c *httpClient) close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+type grpcClient struct {
+	conn   *grpc.ClientConn
+	client collectorpb.MetricsServiceClient
+}
+
+func newGRPCClient(cfg Config) (*grpcClient, error) {
+	creds := credentials.NewTLS(&tls.Config{})
+	if cfg.Insecure {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.NewClient(cfg.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &grpcClient{conn: conn, client: collectorpb.NewMetricsServiceClient(conn)}, nil
+}
+
+func (c *grpcClient) export(ctx context.Context, req *collectorpb.ExportMetricsServiceRequest) error {
+	resp, err := c.client.Export(ctx, req)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange,
+			codes.Unavailable, codes.DataLoss, codes.ResourceExhausted:
+			return recoverableError{err}
+		}
+		return err
+	}
+	return checkPartialSuccess(resp.GetPartialSuccess())
+}
+
+func (c *grpcClient) close() error {
+	return c.conn.Close()
+}
+
+// partialSuccessError means that the endpoint rejected some of the data
+// points. Retrying does not help in that case.
+type partialSuccessError struct {
+	rejected int64
+	message  string
+}
+
+func (e partialSuccessError) Error() string {
+	return fmt.Sprintf("endpoint rejected %d data points: %s", e.rejected, e.message)
+}
+
+func checkPartialSuccess(p *collectorpb.ExportMetricsPartialSuccess) error {
+	if p.GetRejectedDataPoints() == 0 {
+		return nil
+	}
+	return partialSuccessError{rejected: p.GetRejectedDataPoints(), message: p.GetErrorMessage()}
+}
@@ -0,0 +1,429 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otlp pushes samples to an OpenTelemetry collector.
+package otlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/prometheus/graphite_exporter/collector"
+)
+
+const (
+	ProtocolHTTP = "http/protobuf"
+	ProtocolGRPC = "grpc"
+)
+
+// Config configures an Exporter.
+type Config struct {
+	// Endpoint is the URL of the OTLP/HTTP metrics endpoint, such as
+	// http://localhost:4318/v1/metrics, or the host:port of the OTLP/gRPC
+	// endpoint.
+	Endpoint string
+	// Protocol is ProtocolHTTP or ProtocolGRPC.
+	Protocol string
+	// Insecure disables TLS for gRPC.
+	Insecure bool
+	// ResourceLabels are labels that are exported as resource attributes
+	// instead of data point attributes.
+	ResourceLabels []string
+	// QueueCapacity is the number of samples buffered before they are
+	// exported. Samples are dropped when the queue is full.
+	QueueCapacity int
+	// MaxSamplesPerSend is the maximum number of samples per request.
+	MaxSamplesPerSend int
+	// BatchSendDeadline is how long to wait for a batch to fill up.
+	BatchSendDeadline time.Duration
+	// SeriesExpiry is how long the start time of a cumulative series is kept
+	// after its last sample. A series that is seen again afterwards starts
+	// anew. Start times are kept forever if 0.
+	SeriesExpiry time.Duration
+	// Timeout is the timeout for each request.
+	Timeout    time.Duration
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// client sends export requests to an endpoint.
+type client interface {
+	export(ctx context.Context, req *collectorpb.ExportMetricsServiceRequest) error
+	close() error
+}
+
+// recoverableError is an error after which the request can be retried.
+type recoverableError struct {
+	error
+}
+
+// Exporter batches samples and exports them as OTLP metrics. Samples of
+// metrics that their mapping marks as cumulative are exported as monotonic
+// cumulative sums, all others as gauges. A sum starts when its series was
+// first seen, and again whenever its value decreases.
+type Exporter struct {
+	cfg            Config
+	logger         *slog.Logger
+	client         client
+	resourceLabels map[string]bool
+	samples        chan *collector.Sample
+	stop           chan struct{}
+	done           chan struct{}
+
+	// startTimes holds when each cumulative series started and was last
+	// seen, keyed by resource, name and attributes.
+	startMu    sync.Mutex
+	startTimes map[string]seriesTimes
+	lastPrune  time.Time
+
+	samplesTotal   prometheus.Counter
+	failedSamples  prometheus.Counter
+	droppedSamples prometheus.Counter
+}
+
+// NewExporter creates an Exporter and starts exporting samples in the
+// background.
+func NewExporter(cfg Config, logger *slog.Logger) (*Exporter, error) {
+	var (
+		c   client
+		err error
+	)
+	switch cfg.Protocol {
+	case ProtocolHTTP:
+		c = newHTTPClient(cfg)
+	case ProtocolGRPC:
+		c, err = newGRPCClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q", cfg.Protocol)
+	}
+
+	e := &Exporter{
+		cfg:            cfg,
+		logger:         logger,
+		client:         c,
+		resourceLabels: map[string]bool{},
+		samples:        make(chan *collector.Sample, cfg.QueueCapacity),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+		samplesTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "graphite_otlp_samples_total",
+			Help: "Total count of samples exported via OTLP.",
+		}),
+		failedSamples: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "graphite_otlp_failed_samples_total",
+			Help: "Total count of samples rejected by the OTLP endpoint or not exported before shutdown.",
+		}),
+		droppedSamples: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "graphite_otlp_dropped_samples_total",
+			Help: "Total count of samples dropped because the OTLP queue was full.",
+		}),
+	}
+	for _, l := range cfg.ResourceLabels {
+		e.resourceLabels[l] = true
+	}
+
+	go e.run()
+	return e, nil
+}
+
+// Append implements collector.SampleSink. Dropped samples are skipped.
+func (e *Exporter) Append(sample *collector.Sample) {
+	if sample.Dropped {
+		return
+	}
+	select {
+	case e.samples <- sample:
+	default:
+		e.droppedSamples.Inc()
+	}
+}
+
+// Stop exports the queued samples, making a single attempt, and closes the
+// connection.
+func (e *Exporter) Stop() {
+	close(e.stop)
+	<-e.done
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	defer e.client.close()
+
+	timer := time.NewTimer(e.cfg.BatchSendDeadline)
+	defer timer.Stop()
+
+	batch := make([]*collector.Sample, 0, e.cfg.MaxSamplesPerSend)
+	for {
+		full := false
+		select {
+		case s := <-e.samples:
+			batch = append(batch, s)
+			full = len(batch) >= e.cfg.MaxSamplesPerSend
+		case <-timer.C:
+			full = true
+			timer.Reset(e.cfg.BatchSendDeadline)
+		case <-e.stop:
+			for len(e.samples) > 0 {
+				batch = append(batch, <-e.samples)
+				if len(batch) >= e.cfg.MaxSamplesPerSend {
+					e.sendOnce(batch)
+					batch = batch[:0]
+				}
+			}
+			e.sendOnce(batch)
+			return
+		}
+		if full && len(batch) > 0 {
+			if !e.sendWithRetries(batch) {
+				return
+			}
+			batch = batch[:0]
+		}
+	}
+}
+
+func (e *Exporter) sendOnce(batch []*collector.Sample) {
+	if len(batch) == 0 {
+		return
+	}
+	err := e.send(batch)
+	if err == nil {
+		return
+	}
+	e.logger.Error("Error exporting OTLP metrics", "samples", len(batch), "err", err)
+	var recoverable recoverableError
+	if errors.As(err, &recoverable) {
+		e.failedSamples.Add(float64(len(batch)))
+	}
+}
+
+// sendWithRetries exports a batch until it succeeds or fails permanently. It
+// returns false if the exporter was stopped before that.
+func (e *Exporter) sendWithRetries(batch []*collector.Sample) bool {
+	backoff := e.cfg.MinBackoff
+	for {
+		err := e.send(batch)
+		var recoverable recoverableError
+		if !errors.As(err, &recoverable) {
+			if err != nil {
+				e.logger.Error("Error exporting OTLP metrics", "samples", len(batch), "err", err)
+			}
+			return true
+		}
+
+		e.logger.Warn("Error exporting OTLP metrics, retrying", "backoff", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-e.stop:
+			e.failedSamples.Add(float64(len(batch)))
+			return false
+		}
+		backoff = min(2*backoff, e.cfg.MaxBackoff)
+	}
+}
+
+// send exports a batch once and counts the exported and failed samples,
+// unless the error is recoverable.
+func (e *Exporter) send(batch []*collector.Sample) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.cfg.Timeout)
+	defer cancel()
+	err := e.client.export(ctx, e.request(batch))
+
+	var (
+		recoverable recoverableError
+		partial     partialSuccessError
+	)
+	switch {
+	case err == nil:
+		e.samplesTotal.Add(float64(len(batch)))
+	case errors.As(err, &partial):
+		e.samplesTotal.Add(float64(len(batch) - int(partial.rejected)))
+		e.failedSamples.Add(float64(partial.rejected))
+	case errors.As(err, &recoverable):
+	default:
+		e.failedSamples.Add(float64(len(batch)))
+	}
+	return err
+}
+
+// seriesTimes are the start of a series, and the timestamp and value of its
+// last sample.
+type seriesTimes struct {
+	first, last time.Time
+	lastValue   float64
+}
+
+// startTime returns the start time of a cumulative series, which is the
+// timestamp of its first sample. If the value is lower than the one of the
+// previous sample, the source has been reset, and the series starts anew at
+// the previous sample.
+func (e *Exporter) startTime(key string, ts time.Time, value float64) time.Time {
+	e.startMu.Lock()
+	defer e.startMu.Unlock()
+	if e.startTimes == nil {
+		e.startTimes = map[string]seriesTimes{}
+	}
+	st, ok := e.startTimes[key]
+	switch {
+	case !ok:
+		st = seriesTimes{first: ts, last: ts, lastValue: value}
+	case ts.After(st.last):
+		if value < st.lastValue {
+			st.first = st.last
+		}
+		st.last = ts
+		st.lastValue = value
+	case ts.Before(st.first):
+		st.first = ts
+	}
+	e.startTimes[key] = st
+	return st.first
+}
+
+// pruneStartTimes forgets the start times of series that have expired. It
+// only looks at all series once per expiry period.
+func (e *Exporter) pruneStartTimes(now time.Time) {
+	if e.cfg.SeriesExpiry <= 0 {
+		return
+	}
+	e.startMu.Lock()
+	defer e.startMu.Unlock()
+	if now.Sub(e.lastPrune) < e.cfg.SeriesExpiry {
+		return
+	}
+	e.lastPrune = now
+	for key, st := range e.startTimes {
+		if now.Sub(st.last) > e.cfg.SeriesExpiry {
+			delete(e.startTimes, key)
+		}
+	}
+}
+
+// request converts samples into an export request. Samples are grouped into
+// one resource per distinct set of resource attributes, and into one metric
+// per name within a resource.
+func (e *Exporter) request(batch []*collector.Sample) *collectorpb.ExportMetricsServiceRequest {
+	e.pruneStartTimes(time.Now())
+	req := &collectorpb.ExportMetricsServiceRequest{}
+	resources := map[string]*metricspb.ScopeMetrics{}
+	metrics := map[string]*metricspb.Metric{}
+
+	for _, s := range batch {
+		var resourceAttrs, attrs []*commonpb.KeyValue
+		for _, k := range sortedKeys(s.Labels) {
+			kv := &commonpb.KeyValue{
+				Key:   k,
+				Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s.Labels[k]}},
+			}
+			if e.resourceLabels[k] {
+				resourceAttrs = append(resourceAttrs, kv)
+			} else {
+				attrs = append(attrs, kv)
+			}
+		}
+
+		resourceKey := attributesKey(resourceAttrs)
+		scope, ok := resources[resourceKey]
+		if !ok {
+			scope = &metricspb.ScopeMetrics{
+				Scope: &commonpb.InstrumentationScope{Name: "graphite_exporter", Version: version.Version},
+			}
+			req.ResourceMetrics = append(req.ResourceMetrics, &metricspb.ResourceMetrics{
+				Resource:     &resourcepb.Resource{Attributes: resourceAttrs},
+				ScopeMetrics: []*metricspb.ScopeMetrics{scope},
+			})
+			resources[resourceKey] = scope
+		}
+
+		point := &metricspb.NumberDataPoint{
+			Attributes:   attrs,
+			TimeUnixNano: uint64(s.Timestamp.UnixNano()),
+			Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: s.Value},
+		}
+		metricKey := resourceKey + "\xff" + s.Name
+		m, ok := metrics[metricKey]
+		if !ok {
+			m = &metricspb.Metric{Name: s.Name, Description: s.Help, Unit: s.Unit}
+			if s.Type == prometheus.CounterValue {
+				m.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					IsMonotonic:            true,
+				}}
+			} else {
+				m.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{}}
+			}
+			scope.Metrics = append(scope.Metrics, m)
+			metrics[metricKey] = m
+		}
+		switch d := m.Data.(type) {
+		case *metricspb.Metric_Sum:
+			start := e.startTime(metricKey+"\xff"+attributesKey(attrs), s.Timestamp, s.Value)
+			point.StartTimeUnixNano = uint64(start.UnixNano())
+			d.Sum.DataPoints = append(d.Sum.DataPoints, point)
+		case *metricspb.Metric_Gauge:
+			d.Gauge.DataPoints = append(d.Gauge.DataPoints, point)
+		}
+	}
+	return req
+}
+
+func sortedKeys(labels prometheus.Labels) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// attributesKey returns a string that identifies a sorted attribute set.
+func attributesKey(attrs []*commonpb.KeyValue) string {
+	var b strings.Builder
+	for _, kv := range attrs {
+		b.WriteString(kv.Key)
+		b.WriteByte(0xfe)
+		b.WriteString(kv.Value.GetStringValue())
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
+
+// Describe implements prometheus.Collector.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	e.samplesTotal.Describe(ch)
+	e.failedSamples.Describe(ch)
+	e.droppedSamples.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.samplesTotal.Collect(ch)
+	e.failedSamples.Collect(ch)
+	e.droppedSamples.Collect(ch)
+}
@@ -0,0 +1,255 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promslog"
+	"github.com/stretchr/testify/require"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/prometheus/graphite_exporter/collector"
+)
+
+// receiver is a stand-in for an OTLP receiver that records export requests.
+type receiver struct {
+	collectorpb.UnimplementedMetricsServiceServer
+
+	mu       sync.Mutex
+	requests []*collectorpb.ExportMetricsServiceRequest
+	failures int
+}
+
+func (r *receiver) Export(_ context.Context, req *collectorpb.ExportMetricsServiceRequest) (*collectorpb.ExportMetricsServiceResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	return &collectorpb.ExportMetricsServiceResponse{}, nil
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	if r.failures > 0 {
+		r.failures--
+		r.mu.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	r.mu.Unlock()
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var exportReq collectorpb.ExportMetricsServiceRequest
+	if err := proto.Unmarshal(body, &exportReq); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, _ := r.Export(req.Context(), &exportReq)
+	data, _ := proto.Marshal(resp)
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(data)
+}
+
+func (r *receiver) received() []*collectorpb.ExportMetricsServiceRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*collectorpb.ExportMetricsServiceRequest(nil), r.requests...)
+}
+
+func testConfig(protocol, endpoint string) Config {
+	return Config{
+		Endpoint:          endpoint,
+		Protocol:          protocol,
+		Insecure:          true,
+		ResourceLabels:    []string{"host"},
+		QueueCapacity:     100,
+		MaxSamplesPerSend: 100,
+		BatchSendDeadline: 10 * time.Millisecond,
+		Timeout:           time.Second,
+		MinBackoff:        time.Millisecond,
+		MaxBackoff:        10 * time.Millisecond,
+	}
+}
+
+var testSamples = []*collector.Sample{
+	{Name: "cpu", Labels: prometheus.Labels{"host": "web-01", "cpu": "0"}, Value: 1, Timestamp: time.Unix(1700000000, 0), Type: prometheus.GaugeValue},
+	{Name: "cpu", Labels: prometheus.Labels{"host": "web-01", "cpu": "1"}, Value: 2, Timestamp: time.Unix(1700000000, 0), Type: prometheus.GaugeValue},
+	{Name: "requests_total", Labels: prometheus.Labels{"host": "web-01"}, Value: 3, Timestamp: time.Unix(1700000000, 0), Type: prometheus.CounterValue},
+	{Name: "cpu", Labels: prometheus.Labels{"host": "web-02", "cpu": "0"}, Value: 4, Timestamp: time.Unix(1700000000, 0), Type: prometheus.GaugeValue},
+}
+
+func stringAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+// checkRequest verifies that the samples were exported with one resource per
+// host, grouped by metric name.
+func checkRequest(t *testing.T, req *collectorpb.ExportMetricsServiceRequest) {
+	t.Helper()
+	require.Len(t, req.ResourceMetrics, 2)
+
+	web01 := req.ResourceMetrics[0]
+	require.True(t, proto.Equal(stringAttr("host", "web-01"), web01.Resource.Attributes[0]))
+	require.Len(t, web01.Resource.Attributes, 1)
+	metrics := web01.ScopeMetrics[0].Metrics
+	require.Equal(t, "graphite_exporter", web01.ScopeMetrics[0].Scope.Name)
+	require.Len(t, metrics, 2)
+
+	require.Equal(t, "cpu", metrics[0].Name)
+	points := metrics[0].GetGauge().GetDataPoints()
+	require.Len(t, points, 2)
+	require.True(t, proto.Equal(&metricspb.NumberDataPoint{
+		Attributes:   []*commonpb.KeyValue{stringAttr("cpu", "1")},
+		TimeUnixNano: 1700000000 * uint64(time.Second),
+		Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: 2},
+	}, points[1]))
+
+	require.Equal(t, "requests_total", metrics[1].Name)
+	sum := metrics[1].GetSum()
+	require.NotNil(t, sum)
+	require.True(t, sum.IsMonotonic)
+	require.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, sum.AggregationTemporality)
+	require.Equal(t, 3.0, sum.DataPoints[0].GetAsDouble())
+
+	web02 := req.ResourceMetrics[1]
+	require.True(t, proto.Equal(stringAttr("host", "web-02"), web02.Resource.Attributes[0]))
+	require.Equal(t, 4.0, web02.ScopeMetrics[0].Metrics[0].GetGauge().DataPoints[0].GetAsDouble())
+}
+
+func TestExporterHTTP(t *testing.T) {
+	r := &receiver{failures: 1}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	cfg := testConfig(ProtocolHTTP, srv.URL+"/v1/metrics")
+	cfg.BatchSendDeadline = time.Hour
+	cfg.MaxSamplesPerSend = len(testSamples)
+	e, err := NewExporter(cfg, promslog.NewNopLogger())
+	require.NoError(t, err)
+	for _, s := range testSamples {
+		e.Append(s)
+	}
+	require.Eventually(t, func() bool { return len(r.received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	e.Stop()
+
+	checkRequest(t, r.received()[0])
+	require.Equal(t, 4.0, testutil.ToFloat64(e.samplesTotal))
+	require.Equal(t, 0.0, testutil.ToFloat64(e.failedSamples))
+}
+
+func TestExporterGRPC(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	r := &receiver{}
+	srv := grpc.NewServer()
+	collectorpb.RegisterMetricsServiceServer(srv, r)
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	e, err := NewExporter(testConfig(ProtocolGRPC, l.Addr().String()), promslog.NewNopLogger())
+	require.NoError(t, err)
+	for _, s := range testSamples {
+		e.Append(s)
+	}
+	// Stop exports the samples that are still queued.
+	e.Stop()
+
+	var samples int
+	for _, req := range r.received() {
+		for _, rm := range req.ResourceMetrics {
+			for _, m := range rm.ScopeMetrics[0].Metrics {
+				samples += len(m.GetGauge().GetDataPoints()) + len(m.GetSum().GetDataPoints())
+			}
+		}
+	}
+	require.Equal(t, len(testSamples), samples)
+	require.Equal(t, 4.0, testutil.ToFloat64(e.samplesTotal))
+}
+
+func TestRequest(t *testing.T) {
+	e := &Exporter{resourceLabels: map[string]bool{"host": true}}
+	checkRequest(t, e.request(testSamples))
+
+	// Metrics are only exported as sums if their mapping says so, whatever
+	// their name.
+	req := e.request([]*collector.Sample{
+		{Name: "errors_total", Labels: prometheus.Labels{"host": "web-01"}, Value: 1, Timestamp: time.Unix(1700000000, 0), Type: prometheus.GaugeValue},
+	})
+	require.NotNil(t, req.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetGauge())
+}
+
+func TestRequestStartTime(t *testing.T) {
+	e := &Exporter{cfg: Config{SeriesExpiry: 5 * time.Minute}}
+	now := time.Now().Truncate(time.Second)
+	counter := func(host string, ts time.Time) *collector.Sample {
+		return &collector.Sample{Name: "requests_total", Labels: prometheus.Labels{"host": host}, Value: 1, Timestamp: ts, Type: prometheus.CounterValue}
+	}
+	startTimes := func(batch ...*collector.Sample) []time.Time {
+		var times []time.Time
+		for _, p := range e.request(batch).ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetSum().DataPoints {
+			times = append(times, time.Unix(0, int64(p.StartTimeUnixNano)))
+		}
+		return times
+	}
+
+	first := now.Add(-2 * time.Minute)
+	require.Equal(t, []time.Time{first, now.Add(-time.Minute)}, startTimes(counter("web-01", first), counter("web-02", now.Add(-time.Minute))))
+	require.Equal(t, []time.Time{first, now.Add(-time.Minute)}, startTimes(counter("web-01", now), counter("web-02", now)))
+
+	// A series that was not seen within the expiry starts anew.
+	e.startTimes[startTimesKey(t, e, "web-01")] = seriesTimes{first: first, last: now.Add(-10 * time.Minute)}
+	e.lastPrune = time.Time{}
+	require.Equal(t, []time.Time{now}, startTimes(counter("web-01", now)))
+
+	// A series whose value decreases starts anew at the previous sample.
+	increased := counter("web-01", now.Add(time.Minute))
+	increased.Value = 5
+	reset := counter("web-01", now.Add(2*time.Minute))
+	reset.Value = 2
+	require.Equal(t, []time.Time{now, now.Add(time.Minute)}, startTimes(increased, reset))
+	increased = counter("web-01", now.Add(3*time.Minute))
+	increased.Value = 3
+	require.Equal(t, []time.Time{now.Add(time.Minute)}, startTimes(increased))
+}
+
+// startTimesKey returns the key under which the start time of the
+// requests_total series of a host is kept.
+func startTimesKey(t *testing.T, e *Exporter, host string) string {
+	t.Helper()
+	for key := range e.startTimes {
+		if strings.Contains(key, host) {
+			return key
+		}
+	}
+	t.Fatalf("no start time for %s", host)
+	return ""
+}
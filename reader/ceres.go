@@ -0,0 +1,212 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reader
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// ceresNodeFile marks the directory of a metric in a Ceres tree.
+	ceresNodeFile = ".ceres-node"
+	// ceresPointSize is the size of a point in a slice file, a big-endian
+	// float64.
+	ceresPointSize = 8
+)
+
+// NewCeresReader returns a reader for a Ceres database. Each metric is a
+// directory with slice files, named after the timestamp of their first point
+// and the step between points, such as "1600000000@60.slice". If slices with
+// different steps overlap, points are read from the finest one.
+func NewCeresReader(path string) DBReader {
+	return &ceresReader{path: path}
+}
+
+type ceresReader struct {
+	path string
+}
+
+// ceresSlice is a slice file of a metric.
+type ceresSlice struct {
+	path  string
+	start int64
+	step  int64
+	// points is the number of points in the slice, including gaps.
+	points int64
+}
+
+func (s ceresSlice) end() int64 {
+	return s.start + (s.points-1)*s.step
+}
+
+func (c *ceresReader) Metrics() ([]string, error) {
+	metrics := make([]string, 0)
+	err := filepath.WalkDir(c.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != ceresNodeFile {
+			return err
+		}
+		rel, err := filepath.Rel(c.path, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		metrics = append(metrics, strings.ReplaceAll(rel, string(os.PathSeparator), "."))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// slices lists the slice files of a metric from their names and sizes.
+func (c *ceresReader) slices(metric string) ([]ceresSlice, error) {
+	dir := filepath.Join(append([]string{c.path}, strings.Split(metric, ".")...)...)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	slices := make([]ceresSlice, 0, len(entries))
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".slice")
+		if !ok {
+			continue
+		}
+		s := ceresSlice{path: filepath.Join(dir, e.Name())}
+		if _, err := fmt.Sscanf(name, "%d@%d", &s.start, &s.step); err != nil || s.step <= 0 {
+			return nil, fmt.Errorf("invalid slice file name %q", s.path)
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		if s.points = info.Size() / ceresPointSize; s.points > 0 {
+			slices = append(slices, s)
+		}
+	}
+	return slices, nil
+}
+
+// GetMinAndMaxTimestamps returns bounds for the timestamps of all points,
+// derived from the names and sizes of the slice files without reading them.
+// Metrics are listed concurrently.
+func (c *ceresReader) GetMinAndMaxTimestamps() (int64, int64, error) {
+	metrics, err := c.Metrics()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		mu  sync.Mutex
+		min int64 = math.MaxInt64
+		max int64 = math.MinInt64
+		g   errgroup.Group
+	)
+	g.SetLimit(maxConcurrentOpens)
+	for _, metric := range metrics {
+		g.Go(func() error {
+			slices, err := c.slices(metric)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, s := range slices {
+				if s.start < min {
+					min = s.start
+				}
+				if s.end() > max {
+					max = s.end()
+				}
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return 0, 0, err
+	}
+	if min > max {
+		return 0, 0, fmt.Errorf("no valid sample found in %d metrics", len(metrics))
+	}
+	return 1000 * min, 1000 * max, nil
+}
+
+// Points returns the points of a metric after from and up to until, like
+// Whisper does.
+func (c *ceresReader) Points(metric string, from, until int64) ([]Point, error) {
+	slices, err := c.slices(metric)
+	if err != nil {
+		return nil, err
+	}
+	// Finer slices take precedence over coarser ones.
+	sort.SliceStable(slices, func(i, j int) bool { return slices[i].step < slices[j].step })
+
+	from, until = from/1000, until/1000
+	seen := map[int64]struct{}{}
+	var points []Point
+	for _, s := range slices {
+		var first int64
+		if from >= s.start {
+			first = (from-s.start)/s.step + 1
+		}
+		last := min(s.points-1, (until-s.start)/s.step)
+		if until < s.start || first > last {
+			continue
+		}
+		values, err := readSlice(s.path, first, last-first+1)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			ts := s.start + (first+int64(i))*s.step
+			if _, ok := seen[ts]; ok || math.IsNaN(v) {
+				continue
+			}
+			seen[ts] = struct{}{}
+			points = append(points, Point{Timestamp: 1000 * ts, Value: v})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp < points[j].Timestamp })
+	return points, nil
+}
+
+// readSlice reads n values from a slice file, starting at the given index.
+func readSlice(path string, index, n int64) ([]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, n*ceresPointSize)
+	read, err := f.ReadAt(buf, index*ceresPointSize)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	values := make([]float64, read/ceresPointSize)
+	for i := range values {
+		values[i] = math.Float64frombits(binary.BigEndian.Uint64(buf[i*ceresPointSize:]))
+	}
+	return values, nil
+}
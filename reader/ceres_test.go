@@ -0,0 +1,81 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reader
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeCeresNode creates the directory of a metric in a Ceres tree, with a
+// slice file for each entry of slices.
+func writeCeresNode(t *testing.T, root, metric string, slices map[string][]float64) {
+	dir := filepath.Join(root, filepath.FromSlash(metric))
+	require.NoError(t, os.MkdirAll(dir, 0o777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".ceres-node"), []byte(`{"timeStep": 60}`), 0o666))
+	for name, values := range slices {
+		var buf []byte
+		for _, v := range values {
+			buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(v))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), buf, 0o666))
+	}
+}
+
+func TestCeresReader(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".ceres-tree"), 0o777))
+	writeCeresNode(t, root, "servers/a/load", map[string][]float64{
+		"1599999900@60.slice":  {1, math.NaN(), 3},
+		"1599999600@300.slice": {10, 20, 30},
+	})
+	writeCeresNode(t, root, "servers/b/load", map[string][]float64{
+		"1600000000@60.slice": {5},
+	})
+
+	reader := NewCeresReader(root)
+	metrics, err := reader.Metrics()
+	require.NoError(t, err)
+	sort.Strings(metrics)
+	require.Equal(t, []string{"servers.a.load", "servers.b.load"}, metrics)
+
+	min, max, err := reader.GetMinAndMaxTimestamps()
+	require.NoError(t, err)
+	require.Equal(t, int64(1599999600000), min)
+	require.Equal(t, int64(1600000200000), max)
+
+	// The finer slice takes precedence at 1599999900.
+	points, err := reader.Points("servers.a.load", 1000*math.MinInt32, 1000*math.MaxInt32)
+	require.NoError(t, err)
+	require.Equal(t, []Point{
+		{Timestamp: 1599999600000, Value: 10},
+		{Timestamp: 1599999900000, Value: 1},
+		{Timestamp: 1600000020000, Value: 3},
+		{Timestamp: 1600000200000, Value: 30},
+	}, points)
+
+	points, err = reader.Points("servers.a.load", 1599999900000, 1600000020000)
+	require.NoError(t, err)
+	require.Equal(t, []Point{{Timestamp: 1600000020000, Value: 3}}, points)
+
+	points, err = reader.Points("servers.b.load", 1600000000000, 1600000060000)
+	require.NoError(t, err)
+	require.Empty(t, points)
+}
@@ -0,0 +1,183 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// NewPlaintextReader returns a reader for dumps of the Graphite plaintext
+// protocol, with one "path value timestamp" line per point. The path is a
+// file or a directory, of which all files are read. Files may be compressed
+// with gzip.
+//
+// All points are read into memory when they are first needed. If a series has
+// several points with the same timestamp, the one read last wins. Lines that
+// cannot be parsed are skipped and counted.
+func NewPlaintextReader(path string) DBReader {
+	return &plaintextReader{path: path}
+}
+
+type plaintextReader struct {
+	path string
+
+	once    sync.Once
+	err     error
+	series  map[string][]Point
+	skipped int
+}
+
+func (p *plaintextReader) SkippedLines() int {
+	return p.skipped
+}
+
+func (p *plaintextReader) Metrics() ([]string, error) {
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	metrics := make([]string, 0, len(p.series))
+	for m := range p.series {
+		metrics = append(metrics, m)
+	}
+	sort.Strings(metrics)
+	return metrics, nil
+}
+
+func (p *plaintextReader) GetMinAndMaxTimestamps() (int64, int64, error) {
+	if err := p.load(); err != nil {
+		return 0, 0, err
+	}
+	var min, max int64 = math.MaxInt64, math.MinInt64
+	for _, points := range p.series {
+		if t := points[0].Timestamp; t < min {
+			min = t
+		}
+		if t := points[len(points)-1].Timestamp; t > max {
+			max = t
+		}
+	}
+	if min > max {
+		return 0, 0, fmt.Errorf("no valid sample found in %s", p.path)
+	}
+	return min, max, nil
+}
+
+// Points returns the points of a metric after from and up to until, like
+// Whisper does.
+func (p *plaintextReader) Points(metric string, from, until int64) ([]Point, error) {
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	points := p.series[metric]
+	start := sort.Search(len(points), func(i int) bool { return points[i].Timestamp > from })
+	end := sort.Search(len(points), func(i int) bool { return points[i].Timestamp > until })
+	if start >= end {
+		return nil, nil
+	}
+	return append([]Point(nil), points[start:end]...), nil
+}
+
+func (p *plaintextReader) load() error {
+	p.once.Do(func() {
+		p.series = map[string][]Point{}
+		p.err = filepath.WalkDir(p.path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			return p.readFile(path)
+		})
+		for metric, points := range p.series {
+			p.series[metric] = sortPoints(points)
+		}
+	})
+	return p.err
+}
+
+// gzipMagic starts every gzip compressed file.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func (p *plaintextReader) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, _ := br.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			p.skipped++
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			p.skipped++
+			continue
+		}
+		timestamp, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			p.skipped++
+			continue
+		}
+		if math.IsNaN(value) {
+			continue
+		}
+		p.series[fields[0]] = append(p.series[fields[0]], Point{Timestamp: int64(1000 * timestamp), Value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// sortPoints sorts points by timestamp, keeping the last of the points with
+// the same timestamp.
+func sortPoints(points []Point) []Point {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Timestamp < points[j].Timestamp })
+	result := points[:0]
+	for i, p := range points {
+		if i+1 < len(points) && points[i+1].Timestamp == p.Timestamp {
+			continue
+		}
+		result = append(result, p)
+	}
+	return result
+}
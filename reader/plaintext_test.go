@@ -0,0 +1,92 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reader
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaintextReader(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "relay.log"), []byte(`servers.a.load 2 1600000060
+servers.a.load 1 1600000000
+
+servers.b.load nan 1600000000
+servers.b.load 7 1600000120.5
+`), 0o666))
+
+	f, err := os.Create(filepath.Join(dir, "relay.log.1.gz"))
+	require.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	_, err = gz.Write([]byte("servers.a.load 3 1600000060\nservers.a.load 4 1600000180\n"))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, f.Close())
+
+	reader := NewPlaintextReader(dir)
+	metrics, err := reader.Metrics()
+	require.NoError(t, err)
+	require.Equal(t, []string{"servers.a.load", "servers.b.load"}, metrics)
+
+	min, max, err := reader.GetMinAndMaxTimestamps()
+	require.NoError(t, err)
+	require.Equal(t, int64(1600000000000), min)
+	require.Equal(t, int64(1600000180000), max)
+
+	// The compressed file is read after the plain one, so its point at
+	// 1600000060 wins.
+	points, err := reader.Points("servers.a.load", 0, 1700000000000)
+	require.NoError(t, err)
+	require.Equal(t, []Point{
+		{Timestamp: 1600000000000, Value: 1},
+		{Timestamp: 1600000060000, Value: 3},
+		{Timestamp: 1600000180000, Value: 4},
+	}, points)
+
+	points, err = reader.Points("servers.a.load", 1600000000000, 1600000060000)
+	require.NoError(t, err)
+	require.Equal(t, []Point{{Timestamp: 1600000060000, Value: 3}}, points)
+
+	points, err = reader.Points("servers.b.load", 0, 1700000000000)
+	require.NoError(t, err)
+	require.Equal(t, []Point{{Timestamp: 1600000120500, Value: 7}}, points)
+
+	file := filepath.Join(dir, "relay.log")
+	points, err = NewPlaintextReader(file).Points("servers.a.load", 0, 1700000000000)
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+}
+
+func TestPlaintextReaderInvalidLine(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "relay.log")
+	require.NoError(t, os.WriteFile(file, []byte(`servers.a.load 1 1600000000
+servers.a.load 1
+servers.b.load x 1600000000
+servers.c.load 1 yesterday
+servers.a.load 2 1600000060
+`), 0o666))
+	r := NewPlaintextReader(file)
+	metrics, err := r.Metrics()
+	require.NoError(t, err)
+	require.Equal(t, []string{"servers.a.load"}, metrics)
+	points, err := r.Points("servers.a.load", 0, 1700000000000)
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	require.Equal(t, 3, r.(LineSkipper).SkippedLines())
+}
@@ -14,6 +14,7 @@
 package reader
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"math"
 	"os"
@@ -21,8 +22,10 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/go-graphite/go-whisper"
+	"golang.org/x/sync/errgroup"
 )
 
 type DBReader interface {
@@ -31,22 +34,60 @@ type DBReader interface {
 	Points(string, int64, int64) ([]Point, error)
 }
 
+// LineSkipper is implemented by readers of text input. Like the exporter,
+// they skip lines that cannot be parsed instead of failing.
+type LineSkipper interface {
+	// SkippedLines returns the number of lines skipped so far.
+	SkippedLines() int
+}
+
 type Point struct {
 	Timestamp int64
 	Value     float64
 }
 
+// ArchiveMode determines which archives of a Whisper file points are read
+// from.
+type ArchiveMode string
+
+const (
+	// ArchivesFinest reads each part of a time range from the finest archive
+	// that covers it.
+	ArchivesFinest ArchiveMode = "finest"
+	// ArchivesSingle reads the whole time range from the finest archive that
+	// covers all of it, like Graphite does.
+	ArchivesSingle ArchiveMode = "single"
+)
+
 func NewReader(path string) DBReader {
+	return NewReaderWithArchives(path, ArchivesFinest)
+}
+
+// NewReaderWithArchives returns a reader that reads points from the archives
+// selected by mode.
+func NewReaderWithArchives(path string, mode ArchiveMode) DBReader {
 	return &whisperReader{
-		path: path,
+		path:     path,
+		archives: mode,
 	}
 }
 
 type whisperReader struct {
-	path string
-	wdb  whisper.Whisper
+	path     string
+	archives ArchiveMode
+	wdb      whisper.Whisper
 }
 
+// taggedDir is the directory in which carbon and go-carbon store series with
+// tags. The file of a series is in two levels of directories named after the
+// first digits of the SHA-256 hash of its name, and is named after the name
+// with "." encoded as "_DOT_":
+//
+//	_tagged/eff/bdc/some_DOT_metric;tag1=value2;tag2=value_DOT_2.wsp
+const taggedDir = "_tagged"
+
+const taggedDot = "_DOT_"
+
 func (w *whisperReader) Metrics() ([]string, error) {
 	metrics := make([]string, 0)
 	err := filepath.Walk(w.path, func(path string, info os.FileInfo, err error) error {
@@ -55,6 +96,14 @@ func (w *whisperReader) Metrics() ([]string, error) {
 		}
 		path = strings.TrimPrefix(path, strings.TrimSuffix(w.path, string(os.PathSeparator))+string(os.PathSeparator))
 		path = strings.TrimSuffix(path, ".wsp")
+		if strings.HasPrefix(path, taggedDir+string(os.PathSeparator)) {
+			// Series stored by their hash only cannot be decoded.
+			name := strings.ReplaceAll(filepath.Base(path), taggedDot, ".")
+			if strings.Contains(name, ";") {
+				metrics = append(metrics, name)
+			}
+			return nil
+		}
 		metrics = append(metrics, strings.ReplaceAll(path, string(os.PathSeparator), "."))
 		return nil
 	})
@@ -64,54 +113,88 @@ func (w *whisperReader) Metrics() ([]string, error) {
 	return metrics, nil
 }
 
+func (w *whisperReader) filePath(metric string) string {
+	if strings.Contains(metric, ";") {
+		hash := fmt.Sprintf("%x", sha256.Sum256([]byte(metric)))
+		return path.Join(w.path, taggedDir, hash[0:3], hash[3:6], strings.ReplaceAll(metric, ".", taggedDot)) + ".wsp"
+	}
+	return path.Join(append([]string{w.path}, strings.Split(metric, ".")...)...) + ".wsp"
+}
+
 func (w *whisperReader) opendb(metric string) (*whisper.Whisper, error) {
-	path := path.Join(append([]string{w.path}, strings.Split(metric, ".")...)...) + ".wsp"
 	flag := os.O_RDONLY
-	return whisper.OpenWithOptions(path, &whisper.Options{
+	return whisper.OpenWithOptions(w.filePath(metric), &whisper.Options{
 		FLock:        false,
 		OpenFileFlag: &flag,
 	})
 }
 
+// maxConcurrentOpens limits the files opened at once to read their headers.
+const maxConcurrentOpens = 16
+
+// GetMinAndMaxTimestamps returns bounds for the timestamps of all points
+// without reading them. The oldest point of a file is at most as old as its
+// longest retention, and its newest point is not newer than the last time
+// the file was modified. Files whose points have all expired are ignored.
 func (w *whisperReader) GetMinAndMaxTimestamps() (int64, int64, error) {
-	var (
-		// Go-Graphite timestamps are int32.
-		min = math.MaxInt32
-		max = math.MinInt32
-	)
 	metrics, err := w.Metrics()
 	if err != nil {
 		return 0, 0, err
 	}
+
+	var (
+		now = whisper.Now().Unix()
+		mu  sync.Mutex
+		// Go-Graphite timestamps are int32.
+		min int64 = math.MaxInt32
+		max int64 = math.MinInt32
+		g   errgroup.Group
+	)
+	g.SetLimit(maxConcurrentOpens)
 	for _, metric := range metrics {
-		wdb, err := w.opendb(metric)
-		if err != nil {
-			return 0, 0, err
-		}
-		ts, err := wdb.Fetch(math.MinInt32, math.MaxInt32)
-		if err != nil {
-			return 0, 0, err
-		}
-		for _, sample := range ts.Points() {
-			if math.IsNaN(sample.Value) {
-				continue
+		g.Go(func() error {
+			oldest, newest, err := w.bounds(metric, now)
+			if err != nil {
+				return err
 			}
-			if sample.Time < min {
-				min = sample.Time
+			if oldest > newest {
+				return nil
 			}
-			if sample.Time > max {
-				max = sample.Time
+			mu.Lock()
+			defer mu.Unlock()
+			if oldest < min {
+				min = oldest
 			}
-		}
-		err = wdb.Close()
-		if err != nil {
-			return 0, 0, err
-		}
+			if newest > max {
+				max = newest
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return 0, 0, err
 	}
 	if min > max {
-		return 0, 0, fmt.Errorf("no valid sample found (min: %d, max: %v)", min, metrics)
+		return 0, 0, fmt.Errorf("no valid sample found in %d files", len(metrics))
+	}
+	return 1000 * min, 1000 * max, nil
+}
+
+// bounds returns the oldest and newest timestamp a file may have a point for.
+func (w *whisperReader) bounds(metric string, now int64) (int64, int64, error) {
+	info, err := os.Stat(w.filePath(metric))
+	if err != nil {
+		return 0, 0, err
 	}
-	return int64(1000 * min), int64(1000 * max), nil
+	wdb, err := w.opendb(metric)
+	if err != nil {
+		return 0, 0, err
+	}
+	oldest := now - int64(wdb.MaxRetention())
+	if err := wdb.Close(); err != nil {
+		return 0, 0, err
+	}
+	return oldest, min(now, info.ModTime().Unix()), nil
 }
 
 func (w *whisperReader) Points(metric string, from, until int64) ([]Point, error) {
@@ -120,12 +203,23 @@ func (w *whisperReader) Points(metric string, from, until int64) ([]Point, error
 		return nil, err
 	}
 	defer wdb.Close()
-	ts, err := wdb.Fetch(int(from/1000), int(until/1000))
-	if err != nil {
-		return nil, err
+	var samples []whisper.TimeSeriesPoint
+	if w.archives == ArchivesSingle {
+		ts, err := wdb.Fetch(int(from/1000), int(until/1000))
+		if err != nil {
+			return nil, err
+		}
+		if ts != nil {
+			samples = ts.Points()
+		}
+	} else {
+		samples, err = fetchArchives(wdb, int(from/1000), int(until/1000))
+		if err != nil {
+			return nil, err
+		}
 	}
-	points := make([]Point, 0)
-	for _, sample := range ts.Points() {
+	points := make([]Point, 0, len(samples))
+	for _, sample := range samples {
 		if math.IsNaN(sample.Value) {
 			continue
 		}
@@ -134,3 +228,39 @@ func (w *whisperReader) Points(metric string, from, until int64) ([]Point, error
 	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp < points[j].Timestamp })
 	return points, nil
 }
+
+// fetchArchives fetches the points between from and until, reading each part
+// of the range from the finest archive that covers it.
+func fetchArchives(wdb *whisper.Whisper, from, until int) ([]whisper.TimeSeriesPoint, error) {
+	now := int(whisper.Now().Unix())
+	var points []whisper.TimeSeriesPoint
+	// Points after end have been read from finer archives.
+	end := until
+	retentions := wdb.Retentions()
+	for i, r := range retentions {
+		// Fetch reads from the finest archive that covers the start of the
+		// range. Start one step after the oldest point of this archive, so
+		// that it is still picked if the clock advances in between. The
+		// coarsest archive is picked anyway.
+		start := now - r.MaxRetention()
+		if i < len(retentions)-1 {
+			start += r.SecondsPerPoint()
+		}
+		start = max(from, start)
+		if start >= end {
+			continue
+		}
+		ts, err := wdb.Fetch(start, end)
+		if err != nil {
+			return nil, err
+		}
+		if ts != nil {
+			points = append(points, ts.Points()...)
+		}
+		if start == from {
+			break
+		}
+		end = start
+	}
+	return points, nil
+}
@@ -15,6 +15,8 @@ package reader
 
 import (
 	"math"
+	"os"
+	"path/filepath"
 	"sort"
 	"testing"
 	"time"
@@ -50,8 +52,43 @@ func TestGetMinAndMaxTimestamp(t *testing.T) {
 	min, max, err := reader.GetMinAndMaxTimestamps()
 	require.NoError(t, err)
 
-	require.True(t, min > math.MinInt64)
-	require.Equal(t, int64(1611068400000), max)
+	metrics, err := reader.Metrics()
+	require.NoError(t, err)
+	for _, metric := range metrics {
+		points, err := reader.Points(metric, 1000*math.MinInt32, 1000*math.MaxInt32)
+		require.NoError(t, err)
+		require.NotEmpty(t, points)
+		require.LessOrEqual(t, min, points[0].Timestamp)
+		require.GreaterOrEqual(t, max, points[len(points)-1].Timestamp)
+	}
+}
+
+func TestGetMinAndMaxTimestampFromHeaders(t *testing.T) {
+	dir := t.TempDir()
+	now := whisper.Now()
+	retentions, err := whisper.ParseRetentionDefs("1m:1h,1h:1d")
+	require.NoError(t, err)
+	for name, modified := range map[string]time.Time{
+		"recent":  now.Add(-10 * time.Minute),
+		"future":  now.Add(time.Hour),
+		"expired": now.Add(-2 * 24 * time.Hour),
+	} {
+		path := filepath.Join(dir, name+".wsp")
+		wsp, err := whisper.Create(path, retentions, whisper.Average, 0.5)
+		require.NoError(t, err)
+		require.NoError(t, wsp.Close())
+		require.NoError(t, os.Chtimes(path, modified, modified))
+	}
+
+	min, max, err := NewReader(dir).GetMinAndMaxTimestamps()
+	require.NoError(t, err)
+	require.Equal(t, 1000*now.Add(-24*time.Hour).Unix(), min)
+	require.Equal(t, 1000*now.Unix(), max)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "recent.wsp")))
+	require.NoError(t, os.Remove(filepath.Join(dir, "future.wsp")))
+	_, _, err = NewReader(dir).GetMinAndMaxTimestamps()
+	require.Error(t, err)
 }
 
 func TestGetPoints(t *testing.T) {
@@ -75,3 +112,83 @@ func TestGetPoints(t *testing.T) {
 		require.Equal(t, p, points[pos])
 	}
 }
+
+func TestGetPointsArchives(t *testing.T) {
+	dir := t.TempDir()
+	retentions, err := whisper.ParseRetentionDefs("1m:1h,10m:1d")
+	require.NoError(t, err)
+	wsp, err := whisper.Create(filepath.Join(dir, "foo.wsp"), retentions, whisper.Average, 0)
+	require.NoError(t, err)
+	now := int(whisper.Now().Unix())
+	var points []*whisper.TimeSeriesPoint
+	for ts := now - 86400 + 60; ts <= now; ts += 60 {
+		points = append(points, &whisper.TimeSeriesPoint{Time: ts, Value: 1})
+	}
+	require.NoError(t, wsp.UpdateMany(points))
+	require.NoError(t, wsp.Close())
+
+	steps := func(points []Point) map[int64]int {
+		result := map[int64]int{}
+		for i := 1; i < len(points); i++ {
+			require.Less(t, points[i-1].Timestamp, points[i].Timestamp)
+			result[points[i].Timestamp-points[i-1].Timestamp]++
+		}
+		return result
+	}
+	from, until := 1000*int64(now-86400), 1000*int64(now)
+
+	// The last hour is read from the 1m archive, and the rest from the 10m
+	// archive.
+	finest, err := NewReader(dir).Points("foo", from, until)
+	require.NoError(t, err)
+	boundary := sort.Search(len(finest), func(i int) bool { return finest[i].Timestamp > 1000*int64(now-3600+60) })
+	require.Equal(t, map[int64]int{60000: 58}, steps(finest[boundary:]))
+	require.Equal(t, map[int64]int{600000: boundary - 1}, steps(finest[:boundary]))
+	require.Greater(t, boundary, 100)
+	require.Equal(t, 1000*int64(now-now%60), finest[len(finest)-1].Timestamp)
+
+	// The whole day is read from the 10m archive.
+	single, err := NewReaderWithArchives(dir, ArchivesSingle).Points("foo", from, until)
+	require.NoError(t, err)
+	require.Equal(t, map[int64]int{600000: len(single) - 1}, steps(single))
+
+	// Ranges within the 1m archive are read from it in both modes.
+	for _, mode := range []ArchiveMode{ArchivesFinest, ArchivesSingle} {
+		recent, err := NewReaderWithArchives(dir, mode).Points("foo", 1000*int64(now-1800), until)
+		require.NoError(t, err)
+		require.Equal(t, map[int64]int{60000: 29}, steps(recent), mode)
+	}
+}
+
+func TestTaggedMetrics(t *testing.T) {
+	dir := t.TempDir()
+	retentions, err := whisper.ParseRetentionDefs("1m:1d")
+	require.NoError(t, err)
+	now := int(whisper.Now().Unix())
+	for _, file := range []string{
+		// sha256("disk.used;datacenter=dc1;server=web01.example") starts with 23fedb.
+		"_tagged/23f/edb/disk_DOT_used;datacenter=dc1;server=web01_DOT_example.wsp",
+		// Series stored by their hash only are skipped.
+		"_tagged/0a1/b2c/0a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f9.wsp",
+		"servers/web01/load.wsp",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o777))
+		wsp, err := whisper.Create(path, retentions, whisper.Average, 0.5)
+		require.NoError(t, err)
+		require.NoError(t, wsp.Update(42, now))
+		require.NoError(t, wsp.Close())
+	}
+
+	reader := NewReader(dir)
+	metrics, err := reader.Metrics()
+	require.NoError(t, err)
+	sort.Strings(metrics)
+	require.Equal(t, []string{"disk.used;datacenter=dc1;server=web01.example", "servers.web01.load"}, metrics)
+
+	for _, metric := range metrics {
+		points, err := reader.Points(metric, 1000*int64(now-60), 1000*int64(now))
+		require.NoError(t, err)
+		require.Equal(t, []Point{{Timestamp: 1000 * int64(now-now%60), Value: 42}}, points, metric)
+	}
+}
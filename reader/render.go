@@ -0,0 +1,182 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+)
+
+// renderTimeout limits how long a single request to the render API may take.
+const renderTimeout = 5 * time.Minute
+
+// NewRenderReader returns a reader for the HTTP API of Graphite, or of any
+// server that implements it, at baseURL. Metrics are listed with
+// /metrics/find and their points fetched with /render. Series with tags are
+// not listed by /metrics/find, so they are not read. At most concurrency
+// requests are in flight at a time, and at most requestsPerSecond are started
+// per second, unless it is 0.
+//
+// The API does not tell the time range of the metrics, so points can only be
+// read for a given range.
+func NewRenderReader(baseURL string, concurrency int, requestsPerSecond float64) DBReader {
+	limit := rate.Inf
+	if requestsPerSecond > 0 {
+		limit = rate.Limit(requestsPerSecond)
+	}
+	return &renderReader{
+		baseURL:  baseURL,
+		client:   &http.Client{Timeout: renderTimeout},
+		inflight: make(chan struct{}, max(concurrency, 1)),
+		limiter:  rate.NewLimiter(limit, 1),
+	}
+}
+
+type renderReader struct {
+	baseURL  string
+	client   *http.Client
+	inflight chan struct{}
+	limiter  *rate.Limiter
+}
+
+// findNode is a node of the metric tree in the response of /metrics/find.
+type findNode struct {
+	ID   string `json:"id"`
+	Leaf int    `json:"leaf"`
+}
+
+// renderSeries is a series in the JSON response of /render. Each datapoint
+// is a value, which may be null, and a timestamp in seconds.
+type renderSeries struct {
+	Target     string        `json:"target"`
+	Datapoints [][2]*float64 `json:"datapoints"`
+}
+
+// Metrics walks the metric tree, listing the children of the nodes of each
+// level in parallel.
+func (r *renderReader) Metrics() ([]string, error) {
+	var (
+		mu      sync.Mutex
+		metrics []string
+		g, ctx  = errgroup.WithContext(context.Background())
+	)
+	var walk func(query string)
+	walk = func(query string) {
+		g.Go(func() error {
+			var nodes []findNode
+			if err := r.get(ctx, "metrics/find", url.Values{"query": {query}}, &nodes); err != nil {
+				return err
+			}
+			for _, n := range nodes {
+				if n.Leaf == 1 {
+					mu.Lock()
+					metrics = append(metrics, n.ID)
+					mu.Unlock()
+					continue
+				}
+				walk(n.ID + ".*")
+			}
+			return nil
+		})
+	}
+	walk("*")
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	sort.Strings(metrics)
+	return metrics, nil
+}
+
+func (r *renderReader) GetMinAndMaxTimestamps() (int64, int64, error) {
+	return 0, 0, errors.New("the Graphite API does not tell the time range of metrics, it must be given")
+}
+
+// Points returns the points of a metric after from and up to until.
+func (r *renderReader) Points(metric string, from, until int64) ([]Point, error) {
+	var series []renderSeries
+	err := r.get(context.Background(), "render", url.Values{
+		"target": {metric},
+		"format": {"json"},
+		"from":   {strconv.FormatInt(from/1000, 10)},
+		"until":  {strconv.FormatInt(until/1000, 10)},
+	}, &series)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []Point
+	for _, s := range series {
+		for _, dp := range s.Datapoints {
+			if dp[0] == nil || dp[1] == nil {
+				continue
+			}
+			ts := int64(1000 * *dp[1])
+			if ts <= from || ts > until {
+				continue
+			}
+			points = append(points, Point{Timestamp: ts, Value: *dp[0]})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp < points[j].Timestamp })
+	return points, nil
+}
+
+// get requests an API endpoint and decodes its JSON response into v.
+func (r *renderReader) get(ctx context.Context, endpoint string, params url.Values, v any) error {
+	u, err := url.JoinPath(r.baseURL, endpoint)
+	if err != nil {
+		return err
+	}
+	u += "?" + params.Encode()
+
+	select {
+	case r.inflight <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-r.inflight }()
+	if err := r.limiter.Wait(ctx); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("GET %s: %s: %s", u, resp.Status, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("GET %s: %w", u, err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reader
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// graphiteAPI is a stand-in for the Graphite HTTP API that serves a fixed
+// metric tree, and records the maximum number of concurrent requests.
+type graphiteAPI struct {
+	tree     map[string][]string
+	points   map[string][][2]any
+	inflight atomic.Int32
+	max      atomic.Int32
+}
+
+func (a *graphiteAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := a.inflight.Add(1)
+	defer a.inflight.Add(-1)
+	for m := a.max.Load(); n > m && !a.max.CompareAndSwap(m, n); m = a.max.Load() {
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	switch r.URL.Path {
+	case "/graphite/metrics/find":
+		query := strings.TrimSuffix(r.URL.Query().Get("query"), "*")
+		nodes := []map[string]any{}
+		for _, child := range a.tree[query] {
+			_, branch := a.tree[query+child+"."]
+			leaf := 1
+			if branch {
+				leaf = 0
+			}
+			nodes = append(nodes, map[string]any{"id": query + child, "text": child, "leaf": leaf})
+		}
+		json.NewEncoder(w).Encode(nodes)
+	case "/graphite/render":
+		q := r.URL.Query()
+		if q.Get("format") != "json" || q.Get("from") == "" || q.Get("until") == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		target := q.Get("target")
+		json.NewEncoder(w).Encode([]map[string]any{{"target": target, "datapoints": a.points[target]}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestRenderReader(t *testing.T) {
+	api := &graphiteAPI{
+		tree: map[string][]string{
+			"":           {"servers"},
+			"servers.":   {"a", "b", "c"},
+			"servers.a.": {"load", "cpu"},
+			"servers.b.": {"load"},
+			"servers.c.": {"load"},
+		},
+		points: map[string][][2]any{
+			"servers.a.load": {{2.0, 1600000060}, {nil, 1600000120}, {1.0, 1600000000}, {3.0, 1600000180}},
+		},
+	}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	reader := NewRenderReader(server.URL+"/graphite", 2, 0)
+	metrics, err := reader.Metrics()
+	require.NoError(t, err)
+	require.Equal(t, []string{"servers.a.cpu", "servers.a.load", "servers.b.load", "servers.c.load"}, metrics)
+	require.LessOrEqual(t, api.max.Load(), int32(2))
+
+	points, err := reader.Points("servers.a.load", 1600000000000, 1600000180000)
+	require.NoError(t, err)
+	require.Equal(t, []Point{
+		{Timestamp: 1600000060000, Value: 2},
+		{Timestamp: 1600000180000, Value: 3},
+	}, points)
+
+	points, err = reader.Points("servers.b.load", 1600000000000, 1600000180000)
+	require.NoError(t, err)
+	require.Empty(t, points)
+
+	_, _, err = reader.GetMinAndMaxTimestamps()
+	require.Error(t, err)
+
+	_, err = NewRenderReader(server.URL, 1, 0).Metrics()
+	require.ErrorContains(t, err, "404")
+}
+
+func TestRenderReaderRateLimit(t *testing.T) {
+	api := &graphiteAPI{tree: map[string][]string{"": {"a", "b", "c", "d", "e"}}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	reader := NewRenderReader(server.URL+"/graphite", 4, 20)
+	start := time.Now()
+	for i := range 5 {
+		_, err := reader.Points(fmt.Sprintf("%c", 'a'+i), 0, 1000)
+		require.NoError(t, err)
+	}
+	// The first request is started at once, the others 50ms apart.
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+}
@@ -0,0 +1,162 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// destination forwards points to a single carbon endpoint. Points are queued
+// and written in batches over a connection that is re-established with
+// backoff when it fails.
+type destination struct {
+	address string
+	cfg     Config
+	logger  *slog.Logger
+	queue   chan point
+	stop    chan struct{}
+	done    chan struct{}
+	conn    net.Conn
+	buf     []byte
+
+	sent             prometheus.Counter
+	dropped          prometheus.Counter
+	connectionErrors prometheus.Counter
+}
+
+// parseDestination splits a destination of the form host:port[:instance].
+func parseDestination(s string) (address, instance string, err error) {
+	if _, _, err := net.SplitHostPort(s); err == nil {
+		return s, "", nil
+	}
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return "", "", fmt.Errorf("invalid destination %q, expected host:port[:instance]", s)
+	}
+	if _, _, err := net.SplitHostPort(s[:i]); err != nil {
+		return "", "", fmt.Errorf("invalid destination %q, expected host:port[:instance]", s)
+	}
+	return s[:i], s[i+1:], nil
+}
+
+// host returns the host of the destination, as used for consistent hashing.
+func (d *destination) host() string {
+	host, _, _ := net.SplitHostPort(d.address)
+	return host
+}
+
+func (d *destination) enqueue(p point) {
+	select {
+	case d.queue <- p:
+	default:
+		d.dropped.Inc()
+	}
+}
+
+func (d *destination) run() {
+	defer close(d.done)
+	defer d.disconnect()
+
+	batch := make([]point, 0, d.cfg.MaxBatchSize)
+	for {
+		select {
+		case p := <-d.queue:
+			batch = d.fill(append(batch[:0], p))
+		case <-d.stop:
+			d.flush()
+			return
+		}
+
+		backoff := d.cfg.MinBackoff
+		for !d.write(batch) {
+			select {
+			case <-time.After(backoff):
+			case <-d.stop:
+				d.dropped.Add(float64(len(batch)))
+				d.flush()
+				return
+			}
+			backoff = min(2*backoff, d.cfg.MaxBackoff)
+		}
+	}
+}
+
+// fill adds queued points to the batch without waiting for more.
+func (d *destination) fill(batch []point) []point {
+	for len(batch) < d.cfg.MaxBatchSize {
+		select {
+		case p := <-d.queue:
+			batch = append(batch, p)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// flush makes a single attempt to write the queued points when stopping.
+func (d *destination) flush() {
+	batch := make([]point, 0, d.cfg.MaxBatchSize)
+	for len(d.queue) > 0 {
+		batch = d.fill(batch[:0])
+		if !d.write(batch) {
+			d.dropped.Add(float64(len(batch) + len(d.queue)))
+			return
+		}
+	}
+}
+
+// write sends a batch, connecting first if needed. It returns false if the
+// batch has to be retried.
+func (d *destination) write(batch []point) bool {
+	if d.conn == nil {
+		conn, err := net.DialTimeout("tcp", d.address, d.cfg.Timeout)
+		if err != nil {
+			d.logger.Warn("Error connecting to relay destination", "destination", d.address, "err", err)
+			d.connectionErrors.Inc()
+			return false
+		}
+		d.conn = conn
+	}
+
+	if d.cfg.Protocol == ProtocolPickle {
+		d.buf = appendPickle(d.buf[:0], batch)
+	} else {
+		d.buf = appendPlaintext(d.buf[:0], batch)
+	}
+	if err := d.conn.SetWriteDeadline(time.Now().Add(d.cfg.Timeout)); err != nil {
+		d.logger.Warn("Error setting write deadline", "destination", d.address, "err", err)
+	}
+	if _, err := d.conn.Write(d.buf); err != nil {
+		d.logger.Warn("Error writing to relay destination", "destination", d.address, "err", err)
+		d.connectionErrors.Inc()
+		d.disconnect()
+		return false
+	}
+	d.sent.Add(float64(len(batch)))
+	return true
+}
+
+func (d *destination) disconnect() {
+	if d.conn != nil {
+		d.conn.Close()
+		d.conn = nil
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+)
+
+// point is a sample as it is forwarded to carbon.
+type point struct {
+	name      string
+	value     float64
+	timestamp float64
+}
+
+// appendPlaintext appends points in the plaintext protocol.
+func appendPlaintext(buf []byte, points []point) []byte {
+	for _, p := range points {
+		buf = append(buf, p.name...)
+		buf = append(buf, ' ')
+		buf = strconv.AppendFloat(buf, p.value, 'g', -1, 64)
+		buf = append(buf, ' ')
+		buf = strconv.AppendFloat(buf, p.timestamp, 'f', -1, 64)
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+// Pickle opcodes used by appendPickle.
+const (
+	pickleProto      = 0x80
+	pickleEmptyList  = ']'
+	pickleMark       = '('
+	pickleBinUnicode = 'X'
+	pickleBinFloat   = 'G'
+	pickleTuple2     = 0x86
+	pickleAppends    = 'e'
+	pickleStop       = '.'
+)
+
+// appendPickle appends points as a message of the pickle protocol: a 32 bit
+// big endian length followed by a protocol 2 pickle of a list of
+// (name, (timestamp, value)) tuples.
+func appendPickle(buf []byte, points []point) []byte {
+	start := len(buf)
+	buf = append(buf, 0, 0, 0, 0)
+	buf = append(buf, pickleProto, 2, pickleEmptyList, pickleMark)
+	for _, p := range points {
+		buf = append(buf, pickleBinUnicode)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(p.name)))
+		buf = append(buf, p.name...)
+		buf = append(buf, pickleBinFloat)
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(p.timestamp))
+		buf = append(buf, pickleBinFloat)
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(p.value))
+		buf = append(buf, pickleTuple2, pickleTuple2)
+	}
+	buf = append(buf, pickleAppends, pickleStop)
+	binary.BigEndian.PutUint32(buf[start:], uint32(len(buf)-start-4))
+	return buf
+}
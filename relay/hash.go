@@ -0,0 +1,75 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// replicaCount is the number of positions each destination takes on the ring.
+const replicaCount = 100
+
+type ringEntry struct {
+	position int
+	node     int
+}
+
+// hashRing is the consistent hash ring of carbon-relay with the default
+// carbon_ch hash type, so that metrics are routed to the same destinations
+// as before.
+type hashRing struct {
+	entries []ringEntry
+}
+
+// ringPosition returns the first two bytes of the MD5 sum of key.
+func ringPosition(key string) int {
+	sum := md5.Sum([]byte(key))
+	return int(binary.BigEndian.Uint16(sum[:2]))
+}
+
+// nodeKey formats a destination the way carbon does, as the Python
+// representation of its (host, instance) tuple.
+func nodeKey(host, instance string) string {
+	if instance == "" {
+		return fmt.Sprintf("('%s', None)", host)
+	}
+	return fmt.Sprintf("('%s', '%s')", host, instance)
+}
+
+func newHashRing(keys []string) *hashRing {
+	r := &hashRing{}
+	taken := map[int]bool{}
+	for node, key := range keys {
+		for i := 0; i < replicaCount; i++ {
+			position := ringPosition(fmt.Sprintf("%s:%d", key, i))
+			for taken[position] {
+				position++
+			}
+			taken[position] = true
+			r.entries = append(r.entries, ringEntry{position: position, node: node})
+		}
+	}
+	sort.Slice(r.entries, func(i, j int) bool { return r.entries[i].position < r.entries[j].position })
+	return r
+}
+
+// node returns the index of the destination for a metric name.
+func (r *hashRing) node(name string) int {
+	position := ringPosition(name)
+	i := sort.Search(len(r.entries), func(i int) bool { return r.entries[i].position >= position })
+	return r.entries[i%len(r.entries)].node
+}
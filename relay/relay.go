@@ -0,0 +1,233 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package relay forwards received samples to carbon endpoints.
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/prometheus/graphite_exporter/collector"
+)
+
+const (
+	ProtocolPlaintext = "plaintext"
+	ProtocolPickle    = "pickle"
+
+	RoutingConsistentHash = "consistent-hash"
+	RoutingFanout         = "fanout"
+
+	FilterAll      = "all"
+	FilterMapped   = "mapped"
+	FilterUnmapped = "unmapped"
+)
+
+// Config configures a Relay.
+type Config struct {
+	// Destinations are carbon endpoints of the form host:port[:instance].
+	// The instance is only used for consistent hashing.
+	Destinations []string
+	// Protocol is ProtocolPlaintext or ProtocolPickle.
+	Protocol string
+	// Routing is RoutingConsistentHash to send each metric to one
+	// destination, or RoutingFanout to send it to all of them.
+	Routing string
+	// Filter selects the samples to forward by whether a mapping matched.
+	Filter string
+	// Rewrite forwards samples under their mapped name, with the labels as
+	// Graphite tags, instead of the name they were received with.
+	Rewrite bool
+	// QueueCapacity is the number of samples buffered per destination.
+	// Samples are dropped when the buffer is full.
+	QueueCapacity int
+	// MaxBatchSize is the maximum number of samples per write.
+	MaxBatchSize int
+	// Timeout is the timeout for connecting and writing.
+	Timeout    time.Duration
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Relay forwards samples to carbon destinations.
+type Relay struct {
+	cfg          Config
+	destinations []*destination
+	ring         *hashRing
+
+	sent             *prometheus.CounterVec
+	dropped          *prometheus.CounterVec
+	connectionErrors *prometheus.CounterVec
+	queueLength      *prometheus.Desc
+}
+
+// New creates a Relay and starts connecting to the destinations.
+func New(cfg Config, logger *slog.Logger) (*Relay, error) {
+	if len(cfg.Destinations) == 0 {
+		return nil, errors.New("no relay destinations")
+	}
+	switch cfg.Protocol {
+	case ProtocolPlaintext, ProtocolPickle:
+	default:
+		return nil, fmt.Errorf("unknown relay protocol %q", cfg.Protocol)
+	}
+	switch cfg.Routing {
+	case RoutingConsistentHash, RoutingFanout:
+	default:
+		return nil, fmt.Errorf("unknown relay routing %q", cfg.Routing)
+	}
+	switch cfg.Filter {
+	case FilterAll, FilterMapped, FilterUnmapped:
+	default:
+		return nil, fmt.Errorf("unknown relay filter %q", cfg.Filter)
+	}
+
+	r := &Relay{
+		cfg: cfg,
+		sent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "graphite_relay_sent_samples_total",
+			Help: "Total count of samples forwarded to each relay destination.",
+		}, []string{"destination"}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "graphite_relay_dropped_samples_total",
+			Help: "Total count of samples dropped because the queue of a relay destination was full or they could not be sent on shutdown.",
+		}, []string{"destination"}),
+		connectionErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "graphite_relay_connection_errors_total",
+			Help: "Total count of failed connections and writes to each relay destination.",
+		}, []string{"destination"}),
+		queueLength: prometheus.NewDesc(
+			"graphite_relay_queue_samples",
+			"Number of samples waiting to be forwarded to each relay destination.",
+			[]string{"destination"}, nil,
+		),
+	}
+
+	keys := make([]string, 0, len(cfg.Destinations))
+	for _, dest := range cfg.Destinations {
+		address, instance, err := parseDestination(dest)
+		if err != nil {
+			return nil, err
+		}
+		d := &destination{
+			address:          address,
+			cfg:              cfg,
+			logger:           logger,
+			queue:            make(chan point, cfg.QueueCapacity),
+			stop:             make(chan struct{}),
+			done:             make(chan struct{}),
+			sent:             r.sent.WithLabelValues(dest),
+			dropped:          r.dropped.WithLabelValues(dest),
+			connectionErrors: r.connectionErrors.WithLabelValues(dest),
+		}
+		r.destinations = append(r.destinations, d)
+		keys = append(keys, nodeKey(d.host(), instance))
+	}
+	if cfg.Routing == RoutingConsistentHash {
+		r.ring = newHashRing(keys)
+	}
+
+	for _, d := range r.destinations {
+		go d.run()
+	}
+	return r, nil
+}
+
+// Append implements collector.SampleSink. Samples that the mapping
+// configuration drops are forwarded too, so that every accepted line reaches
+// the destinations like with carbon-relay. As they have no mapped name, they
+// keep their original name when rewriting. Samples forwarded under their
+// original name keep their original value, without the scale of the mapping.
+func (r *Relay) Append(sample *collector.Sample) {
+	switch {
+	case r.cfg.Filter == FilterMapped && !sample.Mapped:
+		return
+	case r.cfg.Filter == FilterUnmapped && sample.Mapped:
+		return
+	}
+
+	p := point{
+		name:      sample.OriginalName,
+		value:     sample.OriginalValue,
+		timestamp: float64(sample.Timestamp.Unix()) + float64(sample.Timestamp.Nanosecond())/1e9,
+	}
+	if r.cfg.Rewrite && !sample.Dropped {
+		p.name = taggedName(sample.Name, sample.Labels)
+		p.value = sample.Value
+	}
+
+	if r.ring != nil {
+		r.destinations[r.ring.node(p.name)].enqueue(p)
+		return
+	}
+	for _, d := range r.destinations {
+		d.enqueue(p)
+	}
+}
+
+// taggedName formats a metric name and labels as a Graphite tagged name.
+func taggedName(name string, labels prometheus.Labels) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteString(";")
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(labels[k])
+	}
+	return b.String()
+}
+
+// Stop makes a last attempt to forward the queued samples and closes the
+// connections.
+func (r *Relay) Stop() {
+	for _, d := range r.destinations {
+		close(d.stop)
+	}
+	for _, d := range r.destinations {
+		<-d.done
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (r *Relay) Describe(ch chan<- *prometheus.Desc) {
+	r.sent.Describe(ch)
+	r.dropped.Describe(ch)
+	r.connectionErrors.Describe(ch)
+	ch <- r.queueLength
+}
+
+// Collect implements prometheus.Collector.
+func (r *Relay) Collect(ch chan<- prometheus.Metric) {
+	r.sent.Collect(ch)
+	r.dropped.Collect(ch)
+	r.connectionErrors.Collect(ch)
+	for i, d := range r.destinations {
+		ch <- prometheus.MustNewConstMetric(r.queueLength, prometheus.GaugeValue, float64(len(d.queue)), r.cfg.Destinations[i])
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/graphite_exporter/collector"
+)
+
+// carbonServer accepts plaintext connections and records the lines received.
+type carbonServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	lines    []string
+	conns    []net.Conn
+}
+
+func newCarbonServer(t *testing.T) *carbonServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &carbonServer{listener: l}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					s.mu.Lock()
+					s.lines = append(s.lines, scanner.Text())
+					s.mu.Unlock()
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *carbonServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.lines...)
+}
+
+// disconnect closes all accepted connections.
+func (s *carbonServer) disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+func testConfig(destinations ...string) Config {
+	return Config{
+		Destinations:  destinations,
+		Protocol:      ProtocolPlaintext,
+		Routing:       RoutingFanout,
+		Filter:        FilterAll,
+		QueueCapacity: 100,
+		MaxBatchSize:  10,
+		Timeout:       time.Second,
+		MinBackoff:    time.Millisecond,
+		MaxBackoff:    10 * time.Millisecond,
+	}
+}
+
+var testSamples = []*collector.Sample{
+	{
+		OriginalName:  "servers.web-01.cpu;env=prod",
+		Name:          "servers_cpu",
+		Labels:        prometheus.Labels{"host": "web-01", "env": "prod"},
+		Value:         1.5,
+		OriginalValue: 1.5,
+		Timestamp:     time.Unix(1700000000, 0),
+		Mapped:        true,
+	},
+	{
+		OriginalName:  "unmapped.metric",
+		Name:          "unmapped_metric",
+		Labels:        prometheus.Labels{},
+		Value:         2,
+		OriginalValue: 2,
+		Timestamp:     time.Unix(1700000000, 250000000),
+	},
+}
+
+func TestRelayFanout(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		filter   string
+		rewrite  bool
+		expected []string
+	}{
+		{
+			name:   "all",
+			filter: FilterAll,
+			expected: []string{
+				"servers.web-01.cpu;env=prod 1.5 1700000000",
+				"unmapped.metric 2 1700000000.25",
+			},
+		},
+		{
+			name:     "mapped rewritten",
+			filter:   FilterMapped,
+			rewrite:  true,
+			expected: []string{"servers_cpu;env=prod;host=web-01 1.5 1700000000"},
+		},
+		{
+			name:     "unmapped",
+			filter:   FilterUnmapped,
+			expected: []string{"unmapped.metric 2 1700000000.25"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := newCarbonServer(t), newCarbonServer(t)
+			cfg := testConfig(a.listener.Addr().String(), b.listener.Addr().String())
+			cfg.Filter = tc.filter
+			cfg.Rewrite = tc.rewrite
+			r, err := New(cfg, promslog.NewNopLogger())
+			require.NoError(t, err)
+			for _, s := range testSamples {
+				r.Append(s)
+			}
+			r.Stop()
+
+			for _, s := range []*carbonServer{a, b} {
+				require.Eventually(t, func() bool { return len(s.received()) == len(tc.expected) }, 5*time.Second, 10*time.Millisecond)
+				require.Equal(t, tc.expected, s.received())
+			}
+		})
+	}
+}
+
+func TestRelayDroppedSamples(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		filter   string
+		expected []string
+	}{
+		{
+			name:   "all",
+			filter: FilterAll,
+			expected: []string{
+				"servers.web-01.cpu 1 1700000000",
+				"unmapped.metric 2 1700000000",
+				"debug.metric 3 1700000000",
+			},
+		},
+		{
+			name:     "unmapped",
+			filter:   FilterUnmapped,
+			expected: []string{"unmapped.metric 2 1700000000"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newCarbonServer(t)
+			cfg := testConfig(s.listener.Addr().String())
+			cfg.Filter = tc.filter
+			r, err := New(cfg, promslog.NewNopLogger())
+			require.NoError(t, err)
+			defer r.Stop()
+
+			// With strict matching, the unmapped metric is dropped by the
+			// exporter, but still forwarded.
+			c := collector.NewGraphiteCollector(promslog.NewNopLogger(), true, 5*time.Minute)
+			m := &mapper.MetricMapper{Logger: promslog.NewNopLogger()}
+			require.NoError(t, m.InitFromYAMLString(`mappings:
+- match: servers.*.cpu
+  name: servers_cpu
+  labels:
+    host: $1
+- match: debug.*
+  name: dropped
+  action: drop
+`))
+			c.SetMapper(m)
+			c.AddSampleSink(r)
+			c.ProcessReader(strings.NewReader(strings.Join(tc.expected, "\n") + "\n"))
+
+			require.Eventually(t, func() bool { return len(s.received()) == len(tc.expected) }, 5*time.Second, 10*time.Millisecond)
+			require.Equal(t, tc.expected, s.received())
+		})
+	}
+}
+
+func TestRelayScale(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		rewrite  bool
+		expected string
+	}{
+		{name: "original", expected: "servers.web-01.latency_ms 250 1700000000"},
+		{name: "rewritten", rewrite: true, expected: "servers_latency_seconds;host=web-01 0.25 1700000000"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newCarbonServer(t)
+			cfg := testConfig(s.listener.Addr().String())
+			cfg.Rewrite = tc.rewrite
+			r, err := New(cfg, promslog.NewNopLogger())
+			require.NoError(t, err)
+			defer r.Stop()
+
+			c := collector.NewGraphiteCollector(promslog.NewNopLogger(), false, 5*time.Minute)
+			m := &mapper.MetricMapper{Logger: promslog.NewNopLogger()}
+			require.NoError(t, m.InitFromYAMLString(`mappings:
+- match: servers.*.latency_ms
+  name: servers_latency_seconds
+  scale: 0.001
+  labels:
+    host: $1
+`))
+			c.SetMapper(m)
+			c.AddSampleSink(r)
+			c.ProcessReader(strings.NewReader("servers.web-01.latency_ms 250 1700000000\n"))
+
+			require.Eventually(t, func() bool { return len(s.received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+			require.Equal(t, []string{tc.expected}, s.received())
+		})
+	}
+}
+
+func TestRelayReconnect(t *testing.T) {
+	s := newCarbonServer(t)
+	r, err := New(testConfig(s.listener.Addr().String()), promslog.NewNopLogger())
+	require.NoError(t, err)
+	defer r.Stop()
+
+	r.Append(testSamples[0])
+	require.Eventually(t, func() bool { return len(s.received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	s.disconnect()
+	// The first write after the peer closed the connection may still
+	// succeed, so keep sending until samples arrive over a new connection.
+	require.Eventually(t, func() bool {
+		r.Append(testSamples[1])
+		return len(s.received()) > 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "unmapped.metric 2 1700000000.25", s.received()[1])
+	require.Positive(t, testutil.ToFloat64(r.connectionErrors))
+}
+
+func TestHashRing(t *testing.T) {
+	// Expected destinations as computed by carbon's ConsistentHashRing.
+	ring := newHashRing([]string{
+		nodeKey("10.0.0.1", "a"),
+		nodeKey("10.0.0.1", "b"),
+		nodeKey("10.0.0.2", ""),
+	})
+	for name, node := range map[string]int{
+		"servers.web-01.cpu": 0,
+		"servers.web-02.cpu": 1,
+		"foo.bar":            2,
+		"a.b.c":              1,
+		"carbon.agents.x":    0,
+	} {
+		require.Equal(t, node, ring.node(name), name)
+	}
+}
+
+func TestParseDestination(t *testing.T) {
+	for in, expected := range map[string][2]string{
+		"10.0.0.1:2003":   {"10.0.0.1:2003", ""},
+		"10.0.0.1:2004:a": {"10.0.0.1:2004", "a"},
+		"[::1]:2003":      {"[::1]:2003", ""},
+		"[::1]:2003:b":    {"[::1]:2003", "b"},
+	} {
+		address, instance, err := parseDestination(in)
+		require.NoError(t, err)
+		require.Equal(t, expected, [2]string{address, instance}, in)
+	}
+	_, _, err := parseDestination("10.0.0.1")
+	require.Error(t, err)
+}
+
+func TestAppendPickle(t *testing.T) {
+	b := appendPickle(nil, []point{
+		{name: "foo.bar", value: 1.5, timestamp: 1700000000},
+		{name: "baz", value: -2, timestamp: 1700000000.25},
+	})
+	// Decodes to [('foo.bar', (1700000000.0, 1.5)), ('baz', (1700000000.25, -2.0))].
+	require.Equal(t, "0000004280025d285807000000666f6f2e6261724741d954fc40000000473ff80000000000008686580300000062617a4741d954fc4010000047c0000000000000008686652e", hex.EncodeToString(b))
+}
@@ -0,0 +1,251 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remotewrite
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// batch is an encoded remote write request.
+type batch struct {
+	data    []byte
+	samples int
+}
+
+// batchQueue holds encoded batches until they have been sent. Batches are
+// sent in the order they were pushed, and only the oldest batch is removed.
+type batchQueue interface {
+	// push adds a batch and returns the number of samples dropped to make
+	// room for it.
+	push(data []byte, samples int) (int, error)
+	// peek returns the oldest batch, or false if the queue is empty. If the
+	// batch cannot be read, it returns the number of samples in it along
+	// with the error.
+	peek() (batch, bool, error)
+	// pop removes the oldest batch.
+	pop() error
+	// samples returns the number of samples in the queue.
+	samples() int
+}
+
+type memQueue struct {
+	mu         sync.Mutex
+	maxBatches int
+	batches    []batch
+	count      int
+}
+
+func newMemQueue(maxBatches int) *memQueue {
+	return &memQueue{maxBatches: maxBatches}
+}
+
+func (q *memQueue) push(data []byte, samples int) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.batches) >= q.maxBatches {
+		return samples, nil
+	}
+	q.batches = append(q.batches, batch{data: data, samples: samples})
+	q.count += samples
+	return 0, nil
+}
+
+func (q *memQueue) peek() (batch, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.batches) == 0 {
+		return batch{}, false, nil
+	}
+	return q.batches[0], true, nil
+}
+
+func (q *memQueue) pop() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.batches) > 0 {
+		q.count -= q.batches[0].samples
+		q.batches = q.batches[1:]
+	}
+	return nil
+}
+
+func (q *memQueue) samples() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+// dirQueue keeps each batch in a file in a directory, named by a sequence
+// number. A file starts with the number of samples in the batch as a 32 bit
+// big endian integer, followed by the encoded request. If the files grow
+// larger than maxBytes, the oldest batches are dropped, except for the one
+// that may be being sent.
+type dirQueue struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	next     uint64
+	files    []queuedFile
+	count    int
+	bytes    int64
+}
+
+type queuedFile struct {
+	name    string
+	samples int
+	size    int64
+}
+
+const batchFileSuffix = ".batch"
+
+func newDirQueue(dir string, maxBytes int64) (*dirQueue, error) {
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &dirQueue{dir: dir, maxBytes: maxBytes}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			// Left over from an interrupted write.
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, batchFileSuffix), 10, 64)
+		if err != nil || !strings.HasSuffix(name, batchFileSuffix) {
+			continue
+		}
+		samples, err := readSampleCount(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		q.files = append(q.files, queuedFile{name: name, samples: samples, size: info.Size()})
+		q.count += samples
+		q.bytes += info.Size()
+		q.next = max(q.next, seq+1)
+	}
+	sort.Slice(q.files, func(i, j int) bool { return q.files[i].name < q.files[j].name })
+	return q, nil
+}
+
+func readSampleCount(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var n uint32
+	if err := binary.Read(f, binary.BigEndian, &n); err != nil {
+		return 0, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return int(n), nil
+}
+
+func (q *dirQueue) push(data []byte, samples int) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	name := fmt.Sprintf("%020d%s", q.next, batchFileSuffix)
+	path := filepath.Join(q.dir, name)
+	buf := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(data)), uint32(samples))
+	buf = append(buf, data...)
+	// Write to a temporary file first so that a crash never leaves a
+	// partial batch behind.
+	if err := os.WriteFile(path+".tmp", buf, 0o666); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return 0, err
+	}
+
+	q.next++
+	q.files = append(q.files, queuedFile{name: name, samples: samples, size: int64(len(buf))})
+	q.count += samples
+	q.bytes += int64(len(buf))
+	return q.shrinkLocked()
+}
+
+// shrinkLocked drops the oldest batches until the queue fits into maxBytes,
+// and returns the number of samples dropped. The oldest batch is kept, as it
+// may be being sent.
+func (q *dirQueue) shrinkLocked() (int, error) {
+	dropped := 0
+	for q.maxBytes > 0 && q.bytes > q.maxBytes && len(q.files) > 1 {
+		f := q.files[1]
+		if err := os.Remove(filepath.Join(q.dir, f.name)); err != nil {
+			return dropped, err
+		}
+		q.files = append(q.files[:1], q.files[2:]...)
+		q.count -= f.samples
+		q.bytes -= f.size
+		dropped += f.samples
+	}
+	return dropped, nil
+}
+
+func (q *dirQueue) peek() (batch, bool, error) {
+	q.mu.Lock()
+	if len(q.files) == 0 {
+		q.mu.Unlock()
+		return batch{}, false, nil
+	}
+	f := q.files[0]
+	q.mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(q.dir, f.name))
+	if err != nil {
+		return batch{samples: f.samples}, true, err
+	}
+	if len(data) < 4 {
+		return batch{samples: f.samples}, true, errors.New("truncated batch file " + f.name)
+	}
+	return batch{data: data[4:], samples: f.samples}, true, nil
+}
+
+func (q *dirQueue) pop() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.files) == 0 {
+		return nil
+	}
+	f := q.files[0]
+	q.files = q.files[1:]
+	q.count -= f.samples
+	q.bytes -= f.size
+	return os.Remove(filepath.Join(q.dir, f.name))
+}
+
+func (q *dirQueue) samples() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
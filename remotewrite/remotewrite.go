@@ -0,0 +1,358 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remotewrite sends samples to a Prometheus remote write endpoint.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/prometheus/graphite_exporter/collector"
+)
+
+// Config configures a Sender.
+type Config struct {
+	// URL is the remote write endpoint.
+	URL string
+	// WALDirectory, if set, is where batches are kept until they have been
+	// sent, so that they survive restarts. Otherwise they are kept in memory.
+	WALDirectory string
+	// WALMaxBytes limits the size of the batches kept in the WAL directory.
+	// The oldest batches are dropped when it is exceeded. There is no limit
+	// if 0.
+	WALMaxBytes int64
+	// QueueCapacity is the number of samples buffered in memory before they
+	// are batched. Samples are dropped when the queue is full.
+	QueueCapacity int
+	// MaxSamplesPerSend is the maximum number of samples per request.
+	MaxSamplesPerSend int
+	// BatchSendDeadline is how long to wait for a batch to fill up.
+	BatchSendDeadline time.Duration
+	// MaxPendingBatches limits the batches kept in memory when no WAL
+	// directory is configured. New batches are dropped when it is reached.
+	MaxPendingBatches int
+	// Timeout is the timeout for each request.
+	Timeout    time.Duration
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Sender batches samples and sends them to a remote write endpoint. Batches
+// that fail with a recoverable error are retried until they succeed.
+type Sender struct {
+	cfg     Config
+	logger  *slog.Logger
+	client  *http.Client
+	samples chan prompb.TimeSeries
+	queue   batchQueue
+	notify  chan struct{}
+	stop    chan struct{}
+	// batched is closed once no more batches will be queued.
+	batched chan struct{}
+	sent    chan struct{}
+
+	samplesTotal   prometheus.Counter
+	failedSamples  prometheus.Counter
+	droppedSamples prometheus.Counter
+	retries        prometheus.Counter
+	queueLength    prometheus.GaugeFunc
+	pendingSamples prometheus.GaugeFunc
+	sendDuration   prometheus.Histogram
+}
+
+// NewSender creates a Sender and starts sending samples in the background.
+func NewSender(cfg Config, logger *slog.Logger) (*Sender, error) {
+	var (
+		queue batchQueue
+		err   error
+	)
+	if cfg.WALDirectory != "" {
+		queue, err = newDirQueue(cfg.WALDirectory, cfg.WALMaxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("opening WAL directory: %w", err)
+		}
+	} else {
+		queue = newMemQueue(cfg.MaxPendingBatches)
+	}
+
+	s := &Sender{
+		cfg:     cfg,
+		logger:  logger,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		samples: make(chan prompb.TimeSeries, cfg.QueueCapacity),
+		queue:   queue,
+		notify:  make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		batched: make(chan struct{}),
+		sent:    make(chan struct{}),
+		samplesTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "graphite_remote_write_samples_total",
+			Help: "Total count of samples sent to the remote write endpoint.",
+		}),
+		failedSamples: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "graphite_remote_write_failed_samples_total",
+			Help: "Total count of samples rejected by the remote write endpoint with a non-recoverable error.",
+		}),
+		droppedSamples: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "graphite_remote_write_dropped_samples_total",
+			Help: "Total count of samples dropped because the remote write queue was full.",
+		}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "graphite_remote_write_retries_total",
+			Help: "Total count of remote write requests that were retried.",
+		}),
+		sendDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "graphite_remote_write_send_duration_seconds",
+			Help:    "Duration of remote write requests.",
+			Buckets: prometheus.DefBuckets,
+		}),
+	}
+	s.queueLength = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "graphite_remote_write_queue_samples",
+		Help: "Number of samples waiting to be batched.",
+	}, func() float64 { return float64(len(s.samples)) })
+	s.pendingSamples = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "graphite_remote_write_pending_samples",
+		Help: "Number of batched samples waiting to be sent.",
+	}, func() float64 { return float64(s.queue.samples()) })
+
+	go s.batch()
+	go s.send()
+	return s, nil
+}
+
+// Append implements collector.SampleSink. Dropped samples are skipped.
+func (s *Sender) Append(sample *collector.Sample) {
+	if sample.Dropped {
+		return
+	}
+	ts := prompb.TimeSeries{
+		Labels: make([]prompb.Label, 0, len(sample.Labels)+1),
+		Samples: []prompb.Sample{{
+			Value:     sample.Value,
+			Timestamp: sample.Timestamp.UnixMilli(),
+		}},
+	}
+	ts.Labels = append(ts.Labels, prompb.Label{Name: "__name__", Value: sample.Name})
+	for k, v := range sample.Labels {
+		ts.Labels = append(ts.Labels, prompb.Label{Name: k, Value: v})
+	}
+	sort.Slice(ts.Labels, func(i, j int) bool { return ts.Labels[i].Name < ts.Labels[j].Name })
+
+	select {
+	case s.samples <- ts:
+	default:
+		s.droppedSamples.Inc()
+	}
+}
+
+// Stop batches the queued samples, sends pending batches until one fails, and
+// stops the sender. Batches that were not sent remain in the WAL directory, if
+// configured.
+func (s *Sender) Stop() {
+	close(s.stop)
+	<-s.batched
+	<-s.sent
+}
+
+func (s *Sender) batch() {
+	defer close(s.batched)
+
+	timer := time.NewTimer(s.cfg.BatchSendDeadline)
+	defer timer.Stop()
+
+	batch := make([]prompb.TimeSeries, 0, s.cfg.MaxSamplesPerSend)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.enqueue(batch); err != nil {
+			s.logger.Error("Error buffering remote write batch", "err", err)
+			s.droppedSamples.Add(float64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case ts := <-s.samples:
+			batch = append(batch, ts)
+			if len(batch) >= s.cfg.MaxSamplesPerSend {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+			timer.Reset(s.cfg.BatchSendDeadline)
+		case <-s.stop:
+			for len(s.samples) > 0 {
+				batch = append(batch, <-s.samples)
+			}
+			flush()
+			return
+		}
+	}
+}
+
+func (s *Sender) enqueue(batch []prompb.TimeSeries) error {
+	req := &prompb.WriteRequest{Timeseries: batch}
+	data, err := req.Marshal()
+	if err != nil {
+		return err
+	}
+	dropped, err := s.queue.push(snappy.Encode(nil, data), len(batch))
+	if err != nil {
+		return err
+	}
+	s.droppedSamples.Add(float64(dropped))
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Sender) send() {
+	defer close(s.sent)
+
+	for {
+		b, ok, err := s.queue.peek()
+		if err != nil {
+			s.logger.Error("Error reading remote write batch, dropping it", "err", err)
+			s.failedSamples.Add(float64(b.samples))
+			if err := s.queue.pop(); err != nil {
+				s.logger.Error("Error removing remote write batch", "err", err)
+				return
+			}
+			continue
+		}
+		if !ok {
+			select {
+			case <-s.notify:
+				continue
+			case <-s.batched:
+				if _, ok, _ := s.queue.peek(); ok {
+					continue
+				}
+				return
+			}
+		}
+
+		if !s.sendWithRetries(b) {
+			return
+		}
+		if err := s.queue.pop(); err != nil {
+			s.logger.Error("Error removing remote write batch", "err", err)
+		}
+	}
+}
+
+// sendWithRetries sends a batch until it succeeds or fails permanently. It
+// returns false if the sender was stopped before that.
+func (s *Sender) sendWithRetries(b batch) bool {
+	backoff := s.cfg.MinBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.sendBatch(b.data, attempt)
+		if err == nil {
+			s.samplesTotal.Add(float64(b.samples))
+			return true
+		}
+		var recoverable recoverableError
+		if !errors.As(err, &recoverable) {
+			s.logger.Error("Non-recoverable error sending remote write batch", "samples", b.samples, "err", err)
+			s.failedSamples.Add(float64(b.samples))
+			return true
+		}
+
+		s.logger.Warn("Error sending remote write batch, retrying", "backoff", backoff, "err", err)
+		s.retries.Inc()
+		select {
+		case <-time.After(backoff):
+		case <-s.stop:
+			return false
+		}
+		backoff = min(2*backoff, s.cfg.MaxBackoff)
+	}
+}
+
+type recoverableError struct {
+	error
+}
+
+func (s *Sender) sendBatch(data []byte, attempt int) error {
+	start := time.Now()
+	defer func() { s.sendDuration.Observe(time.Since(start).Seconds()) }()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.cfg.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "graphite_exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if attempt > 0 {
+		req.Header.Set("Retry-Attempt", fmt.Sprint(attempt))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(body))
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return recoverableError{err}
+	}
+	return err
+}
+
+// Describe implements prometheus.Collector.
+func (s *Sender) Describe(ch chan<- *prometheus.Desc) {
+	s.samplesTotal.Describe(ch)
+	s.failedSamples.Describe(ch)
+	s.droppedSamples.Describe(ch)
+	s.retries.Describe(ch)
+	s.queueLength.Describe(ch)
+	s.pendingSamples.Describe(ch)
+	s.sendDuration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (s *Sender) Collect(ch chan<- prometheus.Metric) {
+	s.samplesTotal.Collect(ch)
+	s.failedSamples.Collect(ch)
+	s.droppedSamples.Collect(ch)
+	s.retries.Collect(ch)
+	s.queueLength.Collect(ch)
+	s.pendingSamples.Collect(ch)
+	s.sendDuration.Collect(ch)
+}
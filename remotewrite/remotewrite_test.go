@@ -0,0 +1,213 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remotewrite
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/graphite_exporter/collector"
+)
+
+// receiver is a remote write endpoint that fails the first failures
+// requests with a server error.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	requests int
+	series   []prompb.TimeSeries
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests++
+	if r.failures > 0 {
+		r.failures--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	compressed, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var wr prompb.WriteRequest
+	if err := wr.Unmarshal(data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.series = append(r.series, wr.Timeseries...)
+}
+
+func (r *receiver) received() []prompb.TimeSeries {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]prompb.TimeSeries(nil), r.series...)
+}
+
+func testConfig(url string) Config {
+	return Config{
+		URL:               url,
+		QueueCapacity:     100,
+		MaxSamplesPerSend: 2,
+		BatchSendDeadline: 10 * time.Millisecond,
+		MaxPendingBatches: 10,
+		Timeout:           time.Second,
+		MinBackoff:        time.Millisecond,
+		MaxBackoff:        10 * time.Millisecond,
+	}
+}
+
+func appendSamples(s *Sender, n int) {
+	for i := 0; i < n; i++ {
+		s.Append(&collector.Sample{
+			Name:      "foo",
+			Labels:    prometheus.Labels{"instance": "a", "id": string(rune('a' + i))},
+			Value:     float64(i),
+			Timestamp: time.UnixMilli(int64(1000 * (i + 1))),
+		})
+	}
+}
+
+func TestSender(t *testing.T) {
+	r := &receiver{failures: 2}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	s, err := NewSender(testConfig(srv.URL), promslog.NewNopLogger())
+	require.NoError(t, err)
+	appendSamples(s, 5)
+	require.Eventually(t, func() bool { return len(r.received()) == 5 }, 5*time.Second, 10*time.Millisecond)
+	s.Stop()
+
+	series := r.received()
+	require.Equal(t, []prompb.Label{
+		{Name: "__name__", Value: "foo"},
+		{Name: "id", Value: "a"},
+		{Name: "instance", Value: "a"},
+	}, series[0].Labels)
+	require.Equal(t, []prompb.Sample{{Value: 0, Timestamp: 1000}}, series[0].Samples)
+
+	require.Equal(t, 5.0, testutil.ToFloat64(s.samplesTotal))
+	require.Equal(t, 2.0, testutil.ToFloat64(s.retries))
+	require.Equal(t, 0.0, testutil.ToFloat64(s.failedSamples))
+	require.Equal(t, 0.0, testutil.ToFloat64(s.pendingSamples))
+}
+
+func TestSenderNonRecoverable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	s, err := NewSender(testConfig(srv.URL), promslog.NewNopLogger())
+	require.NoError(t, err)
+	appendSamples(s, 3)
+	require.Eventually(t, func() bool { return testutil.ToFloat64(s.failedSamples) == 3 }, 5*time.Second, 10*time.Millisecond)
+	s.Stop()
+
+	require.Equal(t, 0.0, testutil.ToFloat64(s.retries))
+	require.Equal(t, 0.0, testutil.ToFloat64(s.samplesTotal))
+}
+
+func TestSenderWAL(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	cfg := testConfig(down.URL)
+	cfg.WALDirectory = t.TempDir()
+	s, err := NewSender(cfg, promslog.NewNopLogger())
+	require.NoError(t, err)
+	appendSamples(s, 5)
+	s.Stop()
+	require.Equal(t, 5.0, testutil.ToFloat64(s.pendingSamples))
+
+	r := &receiver{}
+	up := httptest.NewServer(r)
+	defer up.Close()
+
+	cfg.URL = up.URL
+	s, err = NewSender(cfg, promslog.NewNopLogger())
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(r.received()) == 5 }, 5*time.Second, 10*time.Millisecond)
+	s.Stop()
+
+	series := r.received()
+	for i, ts := range series {
+		require.Equal(t, int64(1000*(i+1)), ts.Samples[0].Timestamp)
+	}
+	require.Equal(t, 0.0, testutil.ToFloat64(s.pendingSamples))
+}
+
+func TestDirQueueMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	// Each batch file holds 4 bytes of sample count and 10 of data.
+	q, err := newDirQueue(dir, 30)
+	require.NoError(t, err)
+	for i := range 3 {
+		dropped, err := q.push(bytes.Repeat([]byte{byte(i)}, 10), i+1)
+		require.NoError(t, err)
+		if i < 2 {
+			require.Equal(t, 0, dropped)
+		} else {
+			// The second batch is dropped, the first may be being sent.
+			require.Equal(t, 2, dropped)
+		}
+	}
+	require.Equal(t, 4, q.samples())
+
+	// The limit also applies to batches left from a previous run.
+	q, err = newDirQueue(dir, 30)
+	require.NoError(t, err)
+	dropped, err := q.push(bytes.Repeat([]byte{3}, 10), 4)
+	require.NoError(t, err)
+	require.Equal(t, 3, dropped)
+
+	var contents []byte
+	for {
+		b, ok, err := q.peek()
+		require.NoError(t, err)
+		if !ok {
+			break
+		}
+		contents = append(contents, b.data[0])
+		require.NoError(t, q.pop())
+	}
+	require.Equal(t, []byte{0, 3}, contents)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}